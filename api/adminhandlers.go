@@ -0,0 +1,99 @@
+package api
+
+import (
+	"crypto/subtle"
+	"github.com/Neifen/secret-h/config"
+	"github.com/Neifen/secret-h/view"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"net/http"
+)
+
+// adminAuth protects the admin pages with the admin user and password of the config. Without a password there are
+// no admin pages.
+func adminAuth(cfg config.Config) (echo.MiddlewareFunc, bool) {
+	user, password := cfg.AdminUser, cfg.AdminPassword
+	if password == "" {
+		return nil, false
+	}
+
+	return middleware.BasicAuthWithConfig(middleware.BasicAuthConfig{
+		Realm: "Secret-H Admin",
+		Validator: func(u, p string, _ echo.Context) (bool, error) {
+			userOk := subtle.ConstantTimeCompare([]byte(u), []byte(user)) == 1
+			passwordOk := subtle.ConstantTimeCompare([]byte(p), []byte(password)) == 1
+			return userOk && passwordOk, nil
+		},
+	}), true
+}
+
+// requireHtmx only lets htmx change anything. Browsers send basic auth along with requests from other sites too,
+// but those cannot set the HX-Request header.
+func requireHtmx(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if c.Request().Method != http.MethodGet && c.Request().Header.Get("HX-Request") != "true" {
+			return c.String(http.StatusForbidden, "only the admin pages can do that")
+		}
+		return next(c)
+	}
+}
+
+// e.GET("/admin", s.adminHandler)
+func (s *Session) adminHandler(c echo.Context) error {
+	return view.RenderAdminGames(c, s.gamePool.Overview())
+}
+
+// e.GET("/admin/games", s.adminGamesHandler)
+func (s *Session) adminGamesHandler(c echo.Context) error {
+	return view.RenderAdminGameList(c, s.gamePool.Overview())
+}
+
+// e.GET("/admin/games/:id", s.adminGameHandler)
+func (s *Session) adminGameHandler(c echo.Context) error {
+	g, err := s.gamePool.FindGame(c.Param("id"))
+	if err != nil {
+		return c.Redirect(http.StatusSeeOther, view.Path("/admin"))
+	}
+	return view.RenderAdminGame(c, g)
+}
+
+// e.GET("/admin/games/:id/state", s.adminGameStateHandler)
+func (s *Session) adminGameStateHandler(c echo.Context) error {
+	g, err := s.gamePool.FindGame(c.Param("id"))
+	if err != nil {
+		// the game ended in the meantime
+		c.Response().Header().Set("HX-Redirect", view.Path("/admin"))
+		return c.NoContent(http.StatusOK)
+	}
+	return view.RenderAdminGameState(c, g)
+}
+
+// e.POST("/admin/games/:id/announce", s.adminAnnounceHandler)
+func (s *Session) adminAnnounceHandler(c echo.Context) error {
+	gid := c.Param("id")
+	err := s.gamePool.Announce(gid, c.FormValue("text"))
+	if err != nil {
+		return view.RenderError(c, err)
+	}
+	return view.RenderAdminAnnounced(c, gid, "Message sent")
+}
+
+// e.POST("/admin/games/:id/players/:player/remove", s.adminRemovePlayerHandler)
+func (s *Session) adminRemovePlayerHandler(c echo.Context) error {
+	gid := c.Param("id")
+	err := s.gamePool.RemoveByOperator(gid, c.Param("player"))
+	if err != nil {
+		return view.RenderError(c, err)
+	}
+	return s.adminGameStateHandler(c)
+}
+
+// e.POST("/admin/games/:id/end", s.adminEndGameHandler)
+func (s *Session) adminEndGameHandler(c echo.Context) error {
+	err := s.gamePool.EndGame(c.Param("id"))
+	if err != nil {
+		return view.RenderError(c, err)
+	}
+	c.Response().Header().Set("HX-Redirect", view.Path("/admin"))
+	return c.NoContent(http.StatusOK)
+}
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/Neifen/secret-h/entities"
+	"github.com/Neifen/secret-h/view"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	sessionCookie   = "secret-h-session"
+	sessionLifetime = time.Hour * 24
+	playerKey       = "player"
+)
+
+func newSessionKey() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(fmt.Sprintf("could not create session key: %v", err))
+	}
+	return key
+}
+
+// signToken creates a token of the form payload.signature where the payload is gid|pid|sid|expiry
+func (s *Session) signToken(gid, pid, sid string, expires time.Time) string {
+	payload := fmt.Sprintf("%s|%s|%s|%d", gid, pid, sid, expires.Unix())
+	enc := base64.RawURLEncoding.EncodeToString([]byte(payload))
+
+	return enc + "." + s.sign(enc)
+}
+
+func (s *Session) sign(payload string) string {
+	mac := hmac.New(sha256.New, s.sessionKey)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verifyToken returns the game, player and session id of a token, if the signature is valid and it has not expired
+func (s *Session) verifyToken(token string) (string, string, string, error) {
+	enc, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", "", "", fmt.Errorf("malformed session")
+	}
+
+	if !hmac.Equal([]byte(sig), []byte(s.sign(enc))) {
+		return "", "", "", fmt.Errorf("invalid session signature")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(enc)
+	if err != nil {
+		return "", "", "", fmt.Errorf("malformed session")
+	}
+
+	parts := strings.Split(string(payload), "|")
+	if len(parts) != 4 {
+		return "", "", "", fmt.Errorf("malformed session")
+	}
+
+	expires, err := strconv.ParseInt(parts[3], 10, 64)
+	if err != nil || time.Unix(expires, 0).Before(time.Now()) {
+		return "", "", "", fmt.Errorf("session expired")
+	}
+
+	return parts[0], parts[1], parts[2], nil
+}
+
+// newToken creates a session token for the player, used as cookie or as bearer token of the JSON api
+func (s *Session) newToken(gid string, p *entities.Player) (string, time.Time) {
+	expires := time.Now().Add(sessionLifetime)
+	return s.signToken(gid, p.Uid, p.SessionId(), expires), expires
+}
+
+func (s *Session) setSession(c echo.Context, gid string, p *entities.Player) {
+	token, expires := s.newToken(gid, p)
+	c.SetCookie(&http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     view.Path("/"),
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(s.publicBase(c.Request()), "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func deleteSession(c echo.Context) {
+	c.SetCookie(&http.Cookie{Name: sessionCookie, Value: "", Path: view.Path("/"), Expires: time.Unix(0, 0), HttpOnly: true})
+}
+
+var (
+	errNoSession  = errors.New("no valid session")
+	errOtherGame  = errors.New("you are not part of this game")
+	errPlayerGone = errors.New("the player of this session is no longer part of the game")
+)
+
+// sessionToken is taken from the session cookie, or for clients other than browsers from the Authorization header
+func sessionToken(c echo.Context) (string, bool) {
+	if bearer, ok := strings.CutPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer "); ok {
+		return bearer, true
+	}
+
+	cookie, err := c.Cookie(sessionCookie)
+	if err != nil {
+		return "", false
+	}
+	return cookie.Value, true
+}
+
+// sessionPlayer returns the player the request acts as in the game gid
+func (s *Session) sessionPlayer(c echo.Context, gid string) (*entities.Player, error) {
+	token, ok := sessionToken(c)
+	if !ok {
+		return nil, errNoSession
+	}
+
+	tgid, pid, sid, err := s.verifyToken(token)
+	if err != nil {
+		return nil, errNoSession
+	}
+
+	if tgid != gid {
+		return nil, errOtherGame
+	}
+
+	p, err := s.gamePool.FindPlayer(gid, pid)
+	if err != nil || p.SessionId() != sid {
+		// gone, or continued on another device
+		return nil, errPlayerGone
+	}
+	return p, nil
+}
+
+// requirePlayer only lets requests through that carry a valid session for the game in the url.
+// The acting player is then available via currentPlayer
+func (s *Session) requirePlayer(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		p, err := s.sessionPlayer(c, c.Param("id"))
+		if errors.Is(err, errOtherGame) {
+			return view.RenderMessage(c, "You are not part of this game")
+		}
+		if err != nil {
+			deleteSession(c)
+			return redirectHome(c)
+		}
+
+		c.Set(playerKey, p)
+		return next(c)
+	}
+}
+
+func currentPlayer(c echo.Context) *entities.Player {
+	return c.Get(playerKey).(*entities.Player)
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyToken(t *testing.T) {
+	s := &Session{sessionKey: []byte("0123456789abcdef0123456789abcdef")}
+	other := &Session{sessionKey: []byte("fedcba9876543210fedcba9876543210")}
+	valid := s.signToken("42", "p1", "s1", time.Now().Add(time.Hour))
+	enc, sig, _ := strings.Cut(valid, ".")
+	forged := base64.RawURLEncoding.EncodeToString([]byte("43|p1|s1|9999999999"))
+
+	tests := []struct {
+		name  string
+		token string
+		ok    bool
+	}{
+		{name: "valid", token: valid, ok: true},
+		{name: "expired", token: s.signToken("42", "p1", "s1", time.Now().Add(-time.Second))},
+		{name: "other key", token: other.signToken("42", "p1", "s1", time.Now().Add(time.Hour))},
+		{name: "payload swapped", token: forged + "." + sig},
+		{name: "signature cut", token: enc + "." + sig[:len(sig)-1]},
+		{name: "no signature", token: enc},
+		{name: "empty", token: ""},
+		{name: "signed garbage", token: "bm9wZQ." + s.sign("bm9wZQ")},
+		{name: "signed invalid base64", token: "!!." + s.sign("!!")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gid, pid, sid, err := s.verifyToken(tt.token)
+			if !tt.ok {
+				if err == nil {
+					t.Fatalf("accepted as %v %v %v", gid, pid, sid)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if gid != "42" || pid != "p1" || sid != "s1" {
+				t.Errorf("got %v %v %v", gid, pid, sid)
+			}
+		})
+	}
+}
@@ -1,10 +1,13 @@
 package api
 
 import (
+	"fmt"
 	"github.com/Neifen/secret-h/entities"
 	"github.com/Neifen/secret-h/game"
+	"github.com/Neifen/secret-h/protocol"
 	"github.com/Neifen/secret-h/view"
 	"github.com/labstack/echo/v4"
+	"net/http"
 )
 
 // e.POST("/closePopup", s.closePopupHandler)
@@ -12,103 +15,94 @@ func (s *Session) closePopupHandler(c echo.Context) error {
 	return view.ClosePopup(c)
 }
 
-// e.GET("/lobby/:id/:player", s.lobbyHandler)
+// e.GET("/lobby/:id", s.lobbyHandler)
 func (s *Session) lobbyHandler(c echo.Context) error {
 	c.Response().Header().Set("HX-Refresh", "true")
 	id := c.Param("id")
-	pid := c.Param("player")
+	p := currentPlayer(c)
 
 	g, err := s.gamePool.FindGame(id)
 	if err != nil {
 		return redirectHome(c)
 	}
 
-	p, err := s.gamePool.FindPlayer(id, pid)
-	if err != nil {
-		//todo maybe an observer mode?
-		return redirectHome(c)
-	}
-
-	players := make(map[string]*entities.Player)
-
-	g.Players.Range(func(k, v interface{}) bool {
-		players[k.(string)] = v.(*entities.Player)
-		return true
-	})
-	return view.RenderViewLobby(c, g, players, p)
+	return view.RenderViewLobby(c, g, g.PlayerList(), p)
 }
 
-// e.POST("/cancel-wait/:id/:originPid/:destPid", s.cancelWaitHandler)
+// e.POST("/cancel-wait/:id/:destPid", s.cancelWaitHandler)
 func (s *Session) cancelWaitHandler(c echo.Context) error {
 	gid := c.Param("id")
-	s.gamePool.CancelWait(gid)
+	s.gamePool.CancelWait(gid, currentPlayer(c))
 
 	return s.initVoteHandler(c)
 }
 
-// e.POST("/vote/:id/:originPid/:destPlayer", s.initVoteHandler)
+// e.POST("/vote/:id/:destPid", s.initVoteHandler)
 func (s *Session) initVoteHandler(c echo.Context) error {
 	gid := c.Param("id")
 	destPid := c.Param("destPid")
-	originPid := c.Param("originPid")
+	originPlayer := currentPlayer(c)
 
 	destPlayer, err := s.gamePool.FindPlayer(gid, destPid)
 	if err != nil {
 		return view.RenderError(c, err)
 	}
-	originPlayer, err := s.gamePool.FindPlayer(gid, originPid)
-	if err != nil {
-		return view.RenderError(c, err)
-	}
 
 	v, err := s.gamePool.NewVote(gid, originPlayer, destPlayer)
 	if err != nil {
 		if v != nil {
 			// vote already exists
-			toggled, _ := v.Votes.Load(originPid)
-			return view.RenderVote(c, v.OriginPlayer == originPlayer, gid, toggled.(string), originPid, v.DestPlayer)
+			// empty for a player who joined during the vote
+			toggled, _ := v.Votes.Load(originPlayer.Uid)
+			ballot, _ := toggled.(string)
+			return view.RenderVote(c, v.OriginPlayer == originPlayer, gid, ballot, v.DestPlayer)
 		}
 
 		return view.RenderError(c, err)
 	}
 
 	// brand new vote
-	return view.RenderVote(c, true, gid, "", originPid, v.DestPlayer)
+	return view.RenderVote(c, true, gid, "", v.DestPlayer)
 }
 
-// e.POST("/cancel-vote/:id/", s.cancelVoteHandler)
+// e.POST("/cancel-vote/:id", s.cancelVoteHandler)
 func (s *Session) cancelVoteHandler(c echo.Context) error {
 	gid := c.Param("id")
 
-	s.gamePool.CancelVote(gid)
+	err := s.gamePool.CancelVote(gid, currentPlayer(c))
+	if err != nil {
+		return view.RenderError(c, err)
+	}
 
 	return view.ClosePopup(c)
 }
 
-// e.POST("/make-vote/:id/:originPid/:destPid", s.makeVoteHandler)
+// e.POST("/make-vote/:id/:destPid", s.makeVoteHandler)
 func (s *Session) makeVoteHandler(c echo.Context) error {
 	gid := c.Param("id")
-	originPid := c.Param("originPid")
 	destPid := c.Param("destPid")
+	origin := currentPlayer(c)
 
 	toggle := c.QueryParam("toggle")
+	if !protocol.ValidBallot(toggle) {
+		return c.String(http.StatusBadRequest, fmt.Sprintf("invalid ballot %q", toggle))
+	}
 
 	destPlayer, err := s.gamePool.FindPlayer(gid, destPid)
 	if err != nil {
 		return view.RenderError(c, err)
 	}
-	err = s.gamePool.MakeVote(gid, destPlayer, originPid, toggle)
+	err = s.gamePool.MakeVote(gid, destPlayer, origin.Uid, toggle)
 	if err != nil {
 		return view.RenderError(c, err)
 	}
 
-	return view.RenderVoteButton(c, gid, toggle, originPid, destPlayer)
+	return view.RenderVoteButton(c, gid, toggle, destPlayer)
 }
 
-// e.POST("/finish-vote/:id/:player", s.finishVoteHandler)
+// e.POST("/finish-vote/:id/:destPid", s.finishVoteHandler)
 func (s *Session) finishVoteHandler(c echo.Context) error {
 	gid := c.Param("id")
-	originPid := c.Param("originPid")
 	destPid := c.Param("destPid")
 
 	player, err := s.gamePool.FindPlayer(gid, destPid)
@@ -116,23 +110,30 @@ func (s *Session) finishVoteHandler(c echo.Context) error {
 		return view.RenderError(c, err)
 	}
 
-	result, err := s.gamePool.FinishVote(gid, player)
+	result, err := s.gamePool.FinishVote(gid, currentPlayer(c), player)
 	if err != nil {
 		return view.RenderError(c, err)
 	}
 
 	if !result.Finished {
-		return view.RenderVoteWaitPopup(c, result.Empty, gid, originPid, destPid)
+		return view.RenderVoteWaitPopup(c, result.Empty, gid, destPid)
 	}
 
-	return view.RenderAfterVotePopup(c, result)
+	return view.RenderAfterVotePopup(c, gid, result)
+}
+
+// e.POST("/ack-result/:id", s.ackResultHandler)
+func (s *Session) ackResultHandler(c echo.Context) error {
+	s.gamePool.AckResult(currentPlayer(c))
+
+	return view.ClosePopup(c)
 }
 
 // e.POST("/kill/:id/:player", s.initKillHandler)
 func (s *Session) initKillHandler(c echo.Context) error {
 	gid := c.Param("id")
 	pid := c.Param("player")
-	p, err := s.gamePool.FindPlayer(gid, pid)
+	p, err := s.gamePool.FindPlayerAsHost(gid, currentPlayer(c), pid)
 	if err != nil {
 		return view.RenderError(c, err)
 	}
@@ -140,15 +141,15 @@ func (s *Session) initKillHandler(c echo.Context) error {
 	return view.RenderKillPopup(c, gid, p)
 }
 
-// e.GET("/lobby-qr/:id/", s.lobbyHandler)
+// e.POST("/lobby-qr/:id", s.initLobbyQrPopup)
 func (s *Session) initLobbyQrPopup(c echo.Context) error {
 	gid := c.Param("id")
-	qr, err := game.CreateQr(gid, c.Request())
+	qr, err := game.CreateQr(s.publicBase(c.Request()), gid, s.cfg.QRLevel)
 	if err != nil {
 		return view.RenderError(c, err)
 	}
 
-	return view.RenderQRPopup(c, qr)
+	return view.RenderQRPopup(c, qr, "")
 }
 
 // e.POST("/kill-confirmed/:id/:player", s.killConfirmedHandler)
@@ -160,10 +161,76 @@ func (s *Session) killConfirmedHandler(c echo.Context) error {
 		return view.RenderError(c, err)
 	}
 
-	pName := p.Name
-	err = s.gamePool.RemoveFromGame(gid, pid, true)
+	pName := p.Name()
+	err = s.gamePool.RemoveFromGame(gid, currentPlayer(c), pid, entities.Killed)
 	if err != nil {
 		return view.RenderError(c, err)
 	}
 	return view.RenderKillConfirmPopup(c, pName)
 }
+
+// e.POST("/kick/:id/:player", s.initKickHandler)
+func (s *Session) initKickHandler(c echo.Context) error {
+	gid := c.Param("id")
+	pid := c.Param("player")
+	p, err := s.gamePool.FindPlayerAsHost(gid, currentPlayer(c), pid)
+	if err != nil {
+		return view.RenderError(c, err)
+	}
+
+	return view.RenderKickPopup(c, gid, p)
+}
+
+// e.POST("/kick-confirmed/:id/:player", s.kickConfirmedHandler)
+func (s *Session) kickConfirmedHandler(c echo.Context) error {
+	gid := c.Param("id")
+	pid := c.Param("player")
+
+	err := s.gamePool.RemoveFromGame(gid, currentPlayer(c), pid, entities.Kicked)
+	if err != nil {
+		return view.RenderError(c, err)
+	}
+	return view.ClosePopup(c)
+}
+
+// e.POST("/host/:id/:player", s.transferHostHandler)
+func (s *Session) transferHostHandler(c echo.Context) error {
+	gid := c.Param("id")
+	pid := c.Param("player")
+
+	err := s.gamePool.TransferHost(gid, currentPlayer(c), pid)
+	if err != nil {
+		return view.RenderError(c, err)
+	}
+	return view.ClosePopup(c)
+}
+
+// e.POST("/policy/:id/:policy", s.enactPolicyHandler)
+func (s *Session) enactPolicyHandler(c echo.Context) error {
+	gid := c.Param("id")
+
+	_, err := s.gamePool.EnactPolicy(gid, currentPlayer(c), entities.Policy(c.Param("policy")))
+	if err != nil {
+		return view.RenderError(c, err)
+	}
+	// everybody, the host included, gets the board over the websocket
+	return view.ClosePopup(c)
+}
+
+// e.POST("/rename/:id", s.initRenameHandler)
+func (s *Session) initRenameHandler(c echo.Context) error {
+	gid := c.Param("id")
+
+	return view.RenderRenamePopup(c, gid, currentPlayer(c))
+}
+
+// e.POST("/rename-confirmed/:id", s.renameConfirmedHandler)
+func (s *Session) renameConfirmedHandler(c echo.Context) error {
+	gid := c.Param("id")
+
+	err := s.gamePool.RenamePlayer(gid, currentPlayer(c), c.FormValue("name"))
+	if err != nil {
+		return view.RenderError(c, err)
+	}
+	return view.ClosePopup(c)
+}
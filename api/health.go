@@ -0,0 +1,40 @@
+package api
+
+import (
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+type readiness struct {
+	Ready          bool   `json:"ready"`
+	Store          string `json:"store"` // loaded or failed, the server only listens once the games are restored
+	StoreError     string `json:"storeError,omitempty"`
+	AcceptingGames bool   `json:"acceptingGames"`
+	Draining       bool   `json:"draining"`
+}
+
+// e.GET("/healthz", s.healthzHandler)
+func (s *Session) healthzHandler(c echo.Context) error {
+	return c.String(http.StatusOK, "ok")
+}
+
+// e.GET("/readyz", s.readyzHandler)
+func (s *Session) readyzHandler(c echo.Context) error {
+	r := readiness{
+		Store:          "loaded",
+		AcceptingGames: s.gamePool.Accepting(),
+		Draining:       s.draining.Load(),
+	}
+	if s.loadErr != nil {
+		// games that could not be restored are lost either way, the server still works
+		r.Store = "failed"
+		r.StoreError = s.loadErr.Error()
+	}
+	r.Ready = r.AcceptingGames && !r.Draining
+
+	status := http.StatusOK
+	if !r.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	return c.JSON(status, r)
+}
@@ -14,9 +14,9 @@ func (s *Session) homeHandler(c echo.Context) error {
 
 func redirectHome(c echo.Context) error {
 	if c.Request().Header.Get("Hx-Request") != "true" {
-		return c.Redirect(http.StatusSeeOther, "/")
+		return c.Redirect(http.StatusSeeOther, view.Path("/"))
 	}
 
-	c.Response().Header().Set("HX-Redirect", "/") //HX-Redirect to url
+	c.Response().Header().Set("HX-Redirect", view.Path("/")) //HX-Redirect to url
 	return c.NoContent(http.StatusOK)
 }
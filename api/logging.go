@@ -0,0 +1,74 @@
+package api
+
+import (
+	"github.com/Neifen/secret-h/config"
+	"github.com/Neifen/secret-h/entities"
+	"github.com/Neifen/secret-h/view"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// newLogger logs at the level and in the format of the config, which checked both when it was loaded
+func newLogger(w io.Writer, cfg config.Config) *slog.Logger {
+	var level slog.Level
+	_ = level.UnmarshalText([]byte(cfg.LogLevel))
+
+	opts := &slog.HandlerOptions{Level: level}
+	if cfg.LogFormat == "json" {
+		return slog.New(slog.NewJSONHandler(w, opts))
+	}
+	return slog.New(slog.NewTextHandler(w, opts))
+}
+
+// logger has the request id, the game and the player of a request attached
+func logger(c echo.Context) *slog.Logger {
+	l := slog.Default().With("request_id", c.Response().Header().Get(echo.HeaderXRequestID))
+	if gid := c.Param("id"); gid != "" {
+		l = l.With("game", gid)
+	}
+	if p, ok := c.Get(playerKey).(*entities.Player); ok {
+		l = l.With("player", p.Uid)
+	}
+	return l
+}
+
+// requestLogger logs every request once it is answered, requests for static files only at debug level. It logs the
+// route instead of the url, which would contain the tokens of transfer links.
+func requestLogger() echo.MiddlewareFunc {
+	return middleware.RequestLoggerWithConfig(middleware.RequestLoggerConfig{
+		LogMethod:   true,
+		LogURIPath:  true,
+		LogStatus:   true,
+		LogLatency:  true,
+		LogError:    true,
+		HandleError: true,
+		LogValuesFunc: func(c echo.Context, v middleware.RequestLoggerValues) error {
+			level := slog.LevelInfo
+			switch {
+			case v.Status >= 500:
+				level = slog.LevelError
+			case strings.HasPrefix(v.URIPath, view.Path("/static/")):
+				level = slog.LevelDebug
+			}
+
+			route := c.Path()
+			if route == "" {
+				route = v.URIPath
+			}
+			attrs := []slog.Attr{
+				slog.String("method", v.Method),
+				slog.String("route", route),
+				slog.Int("status", v.Status),
+				slog.Duration("latency", v.Latency),
+			}
+			if v.Error != nil {
+				attrs = append(attrs, slog.String("err", v.Error.Error()))
+			}
+			logger(c).LogAttrs(c.Request().Context(), level, "request", attrs...)
+			return nil
+		},
+	})
+}
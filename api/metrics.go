@@ -0,0 +1,89 @@
+package api
+
+import (
+	"github.com/Neifen/secret-h/events"
+	"github.com/Neifen/secret-h/game"
+	"github.com/Neifen/secret-h/metrics"
+	"github.com/labstack/echo/v4"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	openConnections = metrics.NewGauge("secreth_connections", "Open websockets and event streams of players.", "transport")
+	votesOpened     = metrics.NewCounter("secreth_votes_opened_total", "Votes opened.")
+	votesFinished   = metrics.NewCounter("secreth_votes_finished_total", "Votes finished, by whether the candidate became chancellor.", "result")
+	votesCancelled  = metrics.NewCounter("secreth_votes_cancelled_total", "Votes cancelled by the president.")
+	voteDuration    = metrics.NewHistogram("secreth_vote_duration_seconds", "Time from opening a vote to its result.",
+		[]float64{5, 10, 20, 30, 45, 60, 90, 120, 180, 300, 600})
+	requestDuration = metrics.NewHistogram("secreth_http_request_duration_seconds", "Time to answer http requests, by route.",
+		metrics.DefBuckets, "method", "route", "status")
+)
+
+// registerGameMetrics exposes the games and players of the pool and counts the votes in it
+func registerGameMetrics(gp *game.GamePool) {
+	metrics.NewGaugeFunc("secreth_games_active", "Games running.", func() float64 {
+		games, _ := gp.Count()
+		return float64(games)
+	})
+	metrics.NewGaugeFunc("secreth_players", "Players in running games.", func() float64 {
+		_, players := gp.Count()
+		return float64(players)
+	})
+
+	gp.Observe(voteObserver())
+}
+
+// voteObserver counts votes and measures how long they took, votes restored after a restart have no start
+func voteObserver() events.Subscriber {
+	var mu sync.Mutex
+	opened := map[string]time.Time{} // game code - when its vote was opened
+
+	return func(ev events.Event) {
+		code := ev.Source().Game.Code
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch e := ev.(type) {
+		case events.VoteOpened:
+			votesOpened.Inc()
+			opened[code] = ev.Source().At
+		case events.VoteFinished:
+			result := "failed"
+			if e.Result.Success {
+				result = "passed"
+			}
+			votesFinished.Inc(result)
+			if at, ok := opened[code]; ok {
+				voteDuration.Observe(ev.Source().At.Sub(at).Seconds())
+			}
+			delete(opened, code)
+		case events.VoteCancelled:
+			votesCancelled.Inc()
+			delete(opened, code)
+		case events.GameEnded:
+			delete(opened, code)
+		}
+	}
+}
+
+// measure records how long requests take by route. Websockets and event streams are left out, their requests
+// last as long as the connection.
+func measure(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		start := time.Now()
+		err := next(c)
+
+		if c.IsWebSocket() || strings.HasPrefix(c.Response().Header().Get(echo.HeaderContentType), "text/event-stream") {
+			return err
+		}
+		route := c.Path()
+		if route == "" {
+			route = "unmatched"
+		}
+		requestDuration.Observe(time.Since(start).Seconds(), c.Request().Method, route, strconv.Itoa(c.Response().Status))
+		return err
+	}
+}
@@ -0,0 +1,27 @@
+package api
+
+import (
+	"github.com/Neifen/secret-h/config"
+	"github.com/Neifen/secret-h/mqtt"
+	"log/slog"
+)
+
+// newMQTT connects to the broker of the config, nil if none is set
+func newMQTT(cfg config.Config) *mqtt.Publisher {
+	if cfg.MQTTBroker == "" {
+		return nil
+	}
+
+	p, err := mqtt.NewPublisher(mqtt.Options{
+		Broker:   cfg.MQTTBroker,
+		Prefix:   cfg.MQTTPrefix,
+		ClientId: cfg.MQTTClientId,
+		Username: cfg.MQTTUsername,
+		Password: cfg.MQTTPassword,
+	})
+	if err != nil {
+		slog.Error("not publishing to MQTT", "err", err)
+		return nil
+	}
+	return p
+}
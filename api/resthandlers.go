@@ -0,0 +1,294 @@
+package api
+
+import (
+	"bytes"
+	_ "embed"
+	"errors"
+	"fmt"
+	"github.com/Neifen/secret-h/entities"
+	"github.com/Neifen/secret-h/game"
+	"github.com/Neifen/secret-h/protocol"
+	"github.com/Neifen/secret-h/view"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+//go:embed openapi.yaml
+var openAPI []byte
+
+// e.GET("/api/v1/openapi.yaml", s.openAPIHandler)
+func (s *Session) openAPIHandler(c echo.Context) error {
+	// the server of the description is below the base path
+	spec := bytes.Replace(openAPI, []byte("url: /api/v1"), []byte("url: "+view.Path("/api/v1")), 1)
+	return c.Blob(http.StatusOK, "application/yaml", spec)
+}
+
+// apiError answers a failed request to the JSON api with a structured body
+func apiError(c echo.Context, status int, code string, err error) error {
+	return c.JSON(status, protocol.ErrorBody{Error: protocol.Error{Code: code, Message: err.Error()}})
+}
+
+// apiGameError answers with the status that fits an error of the game pool
+func apiGameError(c echo.Context, err error) error {
+	switch game.KindOf(err) {
+	case game.NotFound:
+		return apiError(c, http.StatusNotFound, protocol.CodeNotFound, err)
+	case game.Forbidden:
+		return apiError(c, http.StatusForbidden, protocol.CodeForbidden, err)
+	case game.Conflict:
+		return apiError(c, http.StatusConflict, protocol.CodeConflict, err)
+	case game.Invalid:
+		return badRequest(c, err)
+	case game.Unavailable:
+		return apiError(c, http.StatusServiceUnavailable, protocol.CodeUnavailable, err)
+	default:
+		logger(c).Error("api request failed", "err", err)
+		return apiError(c, http.StatusInternalServerError, protocol.CodeInternal, errors.New("something went wrong"))
+	}
+}
+
+// requireAPIPlayer is requirePlayer for the JSON api, it answers with errors instead of redirects
+func (s *Session) requireAPIPlayer(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		p, err := s.sessionPlayer(c, c.Param("id"))
+		if errors.Is(err, errOtherGame) {
+			return apiError(c, http.StatusForbidden, protocol.CodeForbidden, err)
+		}
+		if err != nil {
+			c.Response().Header().Set(echo.HeaderWWWAuthenticate, "Bearer")
+			return apiError(c, http.StatusUnauthorized, protocol.CodeUnauthorized, err)
+		}
+
+		c.Set(playerKey, p)
+		return next(c)
+	}
+}
+
+var errInvalidBody = errors.New("invalid request body")
+
+// badRequest answers a request with invalid input
+func badRequest(c echo.Context, err error) error {
+	return apiError(c, http.StatusBadRequest, protocol.CodeInvalid, err)
+}
+
+// apiSession answers starting or joining a game with the token of the new player
+func (s *Session) apiSession(c echo.Context, gid string, p *entities.Player) error {
+	g, err := s.gamePool.FindGame(gid)
+	if err != nil {
+		return apiGameError(c, err)
+	}
+
+	token, expires := s.newToken(gid, p)
+	return c.JSON(http.StatusCreated, protocol.Session{Game: gid, Player: protocol.NewPlayer(g, p), Token: token, ExpiresAt: expires})
+}
+
+// e.POST("/api/v1/games", s.apiStartHandler)
+func (s *Session) apiStartHandler(c echo.Context) error {
+	var req protocol.NameRequest
+	if err := c.Bind(&req); err != nil {
+		return badRequest(c, errInvalidBody)
+	}
+
+	code, p, err := s.gamePool.StartGame(req.Name)
+	if err != nil {
+		return apiGameError(c, err)
+	}
+
+	return s.apiSession(c, code, p)
+}
+
+// e.POST("/api/v1/games/:id/players", s.apiJoinHandler)
+func (s *Session) apiJoinHandler(c echo.Context) error {
+	gid := c.Param("id")
+
+	var req protocol.NameRequest
+	if err := c.Bind(&req); err != nil {
+		return badRequest(c, errInvalidBody)
+	}
+
+	p, err := s.gamePool.JoinGame(gid, req.Name)
+	if err != nil {
+		return apiGameError(c, err)
+	}
+
+	return s.apiSession(c, gid, p)
+}
+
+// e.GET("/api/v1/games/:id", s.apiGameHandler)
+func (s *Session) apiGameHandler(c echo.Context) error {
+	g, err := s.gamePool.FindGame(c.Param("id"))
+	if err != nil {
+		return apiGameError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, protocol.NewHello(g, currentPlayer(c)))
+}
+
+// e.GET("/api/v1/games/:id/players", s.apiPlayersHandler)
+func (s *Session) apiPlayersHandler(c echo.Context) error {
+	g, err := s.gamePool.FindGame(c.Param("id"))
+	if err != nil {
+		return apiGameError(c, err)
+	}
+
+	players := []protocol.Player{}
+	for _, p := range g.PlayerList() {
+		players = append(players, protocol.NewPlayer(g, p))
+	}
+	return c.JSON(http.StatusOK, players)
+}
+
+// e.DELETE("/api/v1/games/:id/players/:player", s.apiRemovePlayerHandler)
+// removes yourself, or as host kicks another player, ?reason=killed kills them instead
+func (s *Session) apiRemovePlayerHandler(c echo.Context) error {
+	gid := c.Param("id")
+	pid := c.Param("player")
+	p := currentPlayer(c)
+
+	reason := entities.Left
+	if pid != p.Uid {
+		switch c.QueryParam("reason") {
+		case "", protocol.ReasonKicked:
+			reason = entities.Kicked
+		case protocol.ReasonKilled:
+			reason = entities.Killed
+		default:
+			return badRequest(c, fmt.Errorf("unknown reason %q", c.QueryParam("reason")))
+		}
+	}
+
+	err := s.gamePool.RemoveFromGame(gid, p, pid, reason)
+	if err != nil {
+		return apiGameError(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// e.POST("/api/v1/games/:id/vote", s.apiOpenVoteHandler)
+func (s *Session) apiOpenVoteHandler(c echo.Context) error {
+	gid := c.Param("id")
+	p := currentPlayer(c)
+
+	var req protocol.VoteRequest
+	if err := c.Bind(&req); err != nil {
+		return badRequest(c, errInvalidBody)
+	}
+
+	candidate, err := s.gamePool.FindPlayer(gid, req.Candidate)
+	if err != nil {
+		return apiGameError(c, err)
+	}
+
+	v, err := s.gamePool.NewVote(gid, p, candidate)
+	if err != nil {
+		return apiGameError(c, err)
+	}
+
+	g, err := s.gamePool.FindGame(gid)
+	if err != nil {
+		return apiGameError(c, err)
+	}
+	return c.JSON(http.StatusCreated, protocol.NewVote(g, v, p))
+}
+
+// e.DELETE("/api/v1/games/:id/vote", s.apiCancelVoteHandler)
+func (s *Session) apiCancelVoteHandler(c echo.Context) error {
+	err := s.gamePool.CancelVote(c.Param("id"), currentPlayer(c))
+	if err != nil {
+		return apiGameError(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// e.PUT("/api/v1/games/:id/vote/ballot", s.apiBallotHandler)
+func (s *Session) apiBallotHandler(c echo.Context) error {
+	gid := c.Param("id")
+	p := currentPlayer(c)
+
+	var req protocol.BallotRequest
+	if err := c.Bind(&req); err != nil {
+		return badRequest(c, errInvalidBody)
+	}
+	if !protocol.ValidBallot(req.Ballot) {
+		return badRequest(c, fmt.Errorf("invalid ballot %q", req.Ballot))
+	}
+
+	candidate, err := s.gamePool.FindPlayer(gid, req.Candidate)
+	if err != nil {
+		return apiGameError(c, err)
+	}
+
+	err = s.gamePool.MakeVote(gid, candidate, p.Uid, req.Ballot)
+	if err != nil {
+		return apiGameError(c, err)
+	}
+
+	g, err := s.gamePool.FindGame(gid)
+	if err != nil {
+		return apiGameError(c, err)
+	}
+	v := g.Vote
+	if v == nil {
+		// finished in the meantime
+		return c.NoContent(http.StatusNoContent)
+	}
+	return c.JSON(http.StatusOK, protocol.NewVote(g, v, p))
+}
+
+// e.POST("/api/v1/games/:id/vote/finish", s.apiFinishVoteHandler)
+func (s *Session) apiFinishVoteHandler(c echo.Context) error {
+	gid := c.Param("id")
+
+	var req protocol.VoteRequest
+	if err := c.Bind(&req); err != nil {
+		return badRequest(c, errInvalidBody)
+	}
+
+	candidate, err := s.gamePool.FindPlayer(gid, req.Candidate)
+	if err != nil {
+		return apiGameError(c, err)
+	}
+
+	result, err := s.gamePool.FinishVote(gid, currentPlayer(c), candidate)
+	if err != nil {
+		return apiGameError(c, err)
+	}
+
+	if !result.Finished {
+		g, err := s.gamePool.FindGame(gid)
+		if err != nil {
+			return apiGameError(c, err)
+		}
+
+		fv := protocol.FinishVote{Missing: []protocol.Player{}}
+		for _, m := range result.Empty {
+			fv.Missing = append(fv.Missing, protocol.NewPlayer(g, m))
+		}
+		return c.JSON(http.StatusOK, fv)
+	}
+
+	r := protocol.NewResult(result)
+	return c.JSON(http.StatusOK, protocol.FinishVote{Finished: true, Result: &r})
+}
+
+// e.POST("/api/v1/games/:id/policies", s.apiEnactPolicyHandler)
+func (s *Session) apiEnactPolicyHandler(c echo.Context) error {
+	gid := c.Param("id")
+
+	var req protocol.PolicyRequest
+	if err := c.Bind(&req); err != nil {
+		return badRequest(c, errInvalidBody)
+	}
+
+	policies, err := s.gamePool.EnactPolicy(gid, currentPlayer(c), entities.Policy(req.Policy))
+	if err != nil {
+		return apiGameError(c, err)
+	}
+	return c.JSON(http.StatusOK, protocol.NewPolicies(policies))
+}
+
+// e.POST("/api/v1/games/:id/result/ack", s.apiAckResultHandler)
+func (s *Session) apiAckResultHandler(c echo.Context) error {
+	s.gamePool.AckResult(currentPlayer(c))
+	return c.NoContent(http.StatusNoContent)
+}
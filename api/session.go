@@ -1,49 +1,263 @@
 package api
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"github.com/Neifen/secret-h/config"
 	"github.com/Neifen/secret-h/game"
+	"github.com/Neifen/secret-h/metrics"
+	"github.com/Neifen/secret-h/mqtt"
+	"github.com/Neifen/secret-h/view"
+	"github.com/Neifen/secret-h/webhooks"
 	"github.com/labstack/echo/v4"
-	"log"
+	"github.com/labstack/echo/v4/middleware"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 )
 
+// shutdownTimeout is how long open requests and connections get to finish when the server stops
+const shutdownTimeout = time.Second * 10
+
 type Session struct {
-	gamePool *game.GamePool
+	cfg        config.Config
+	proxies    []netip.Prefix // trusted proxies, from the config
+	gamePool   *game.GamePool
+	sessionKey []byte
+	webhooks   *webhooks.Dispatcher
+	mqtt       *mqtt.Publisher // nil without a broker
+	conns      sync.WaitGroup  // open websockets and event streams
+
+	loadErr  error       // why the games of the last run could not be restored, set before Start
+	draining atomic.Bool // shutting down, proxies should stop sending traffic
 }
 
-func NewSession() *Session {
-	return &Session{
-		gamePool: game.NewGamePool(),
+func NewSession(cfg config.Config) *Session {
+	slog.SetDefault(newLogger(os.Stdout, cfg))
+	slog.Info("config", cfg.Redacted()...)
+	view.SetBasePath(cfg.BasePath)
+
+	// the config checked the proxies when it was loaded
+	proxies, _ := config.ParsePrefixes(cfg.TrustedProxies)
+	s := &Session{
+		cfg:        cfg,
+		proxies:    proxies,
+		gamePool:   game.NewGamePool(cfg.GameTTL),
+		sessionKey: newSessionKey(),
+		webhooks:   newDispatcher(cfg),
+		mqtt:       newMQTT(cfg),
+	}
+	s.gamePool.Observe(s.webhooks.Observer())
+	if s.mqtt != nil {
+		s.gamePool.Observe(s.mqtt.Observer())
+	}
+	registerGameMetrics(s.gamePool)
+
+	err := s.loadState()
+	if err != nil {
+		slog.Error("could not restore games", "err", err)
+		s.loadErr = err
 	}
+	return s
 }
 
-func (s *Session) Start() {
+// Handler serves every route of the server, Start listens with it. Tests mount it on an httptest.Server.
+func (s *Session) Handler() http.Handler {
+	return s.routes()
+}
+
+func (s *Session) routes() *echo.Echo {
 	e := echo.New()
-	//e.Use(middleware.Logger())
-	e.Static("/static", "assets")
-
-	e.GET("/", s.homeHandler)
-	e.POST("/start", s.startHandler)
-	e.POST("/join", s.joinHandler)
-	e.GET("/join-qr/:id", s.joinQrHandler)
-
-	e.POST("/leave/:id/:player", s.leaveHandler)
-	e.POST("/leave-confirmed/:id/:player", s.leaveConfirmedHandler)
-
-	e.GET("/ws/:id/:player", s.wsHandler)
-
-	e.GET("/lobby/:id/:player", s.lobbyHandler)
-	e.POST("/lobby-qr/:id", s.initLobbyQrPopup)
-	e.POST("/kill/:id/:player", s.initKillHandler)
-	e.POST("/kill-confirmed/:id/:player", s.killConfirmedHandler)
-	e.POST("/vote/:id/:originPid/:destPid", s.initVoteHandler)
-	e.POST("/make-vote/:id/:originPid/:destPid", s.makeVoteHandler)
-	e.POST("/cancel-vote/:id", s.cancelVoteHandler)
-	e.POST("/finish-vote/:id/:originPid/:destPid", s.finishVoteHandler)
-	e.POST("/cancel-wait/:id/:originPid/:destPid", s.cancelWaitHandler)
-	e.POST("/closePopup", s.closePopupHandler)
-
-	err := e.Start(":8148")
+	e.HideBanner = true
+	e.HidePort = true
+	e.Use(middleware.RequestID(), measure, requestLogger())
+	if s.cfg.HSTSMaxAge > 0 {
+		e.Use(s.hsts)
+	}
+	// every route is below the base path, which is empty unless the server shares its host
+	r := e.Group(s.cfg.BasePath)
+	if s.cfg.BasePath != "" {
+		e.GET(s.cfg.BasePath, func(c echo.Context) error {
+			return c.Redirect(http.StatusMovedPermanently, view.Path("/"))
+		})
+	}
+	r.Static("/static", s.cfg.Assets)
+	r.GET("/metrics", echo.WrapHandler(metrics.Handler()))
+	r.GET("/healthz", s.healthzHandler)
+	r.GET("/readyz", s.readyzHandler)
+
+	r.GET("/", s.homeHandler)
+	r.POST("/start", s.startHandler)
+	r.POST("/join", s.joinHandler)
+	r.GET("/join-qr/:id", s.joinQrHandler)
+	r.GET("/transfer/:id/:token", s.transferHandler)
+
+	// everything below acts as the player of the session cookie
+	p := r.Group("", s.requirePlayer)
+	p.POST("/leave/:id", s.leaveHandler)
+	p.POST("/leave-confirmed/:id", s.leaveConfirmedHandler)
+
+	p.GET("/ws/:id", s.wsHandler)
+	p.GET("/sse/:id", s.sseHandler)
+
+	p.GET("/lobby/:id", s.lobbyHandler)
+	p.POST("/lobby-qr/:id", s.initLobbyQrPopup)
+	p.POST("/transfer-qr/:id", s.initTransferQrPopup)
+	p.POST("/kill/:id/:player", s.initKillHandler)
+	p.POST("/kill-confirmed/:id/:player", s.killConfirmedHandler)
+	p.POST("/kick/:id/:player", s.initKickHandler)
+	p.POST("/kick-confirmed/:id/:player", s.kickConfirmedHandler)
+	p.POST("/host/:id/:player", s.transferHostHandler)
+	p.POST("/policy/:id/:policy", s.enactPolicyHandler)
+	p.POST("/rename/:id", s.initRenameHandler)
+	p.POST("/rename-confirmed/:id", s.renameConfirmedHandler)
+	p.POST("/vote/:id/:destPid", s.initVoteHandler)
+	p.POST("/make-vote/:id/:destPid", s.makeVoteHandler)
+	p.POST("/cancel-vote/:id", s.cancelVoteHandler)
+	p.POST("/finish-vote/:id/:destPid", s.finishVoteHandler)
+	p.POST("/cancel-wait/:id/:destPid", s.cancelWaitHandler)
+	p.POST("/ack-result/:id", s.ackResultHandler)
+	r.POST("/closePopup", s.closePopupHandler)
+
+	// JSON api for bots and other clients, described in api/openapi.yaml
+	v1 := r.Group("/api/v1")
+	v1.GET("/openapi.yaml", s.openAPIHandler)
+	v1.POST("/games", s.apiStartHandler)
+	v1.POST("/games/:id/players", s.apiJoinHandler)
+
+	a := v1.Group("/games/:id", s.requireAPIPlayer)
+	a.GET("", s.apiGameHandler)
+	a.GET("/players", s.apiPlayersHandler)
+	a.DELETE("/players/:player", s.apiRemovePlayerHandler)
+	a.POST("/vote", s.apiOpenVoteHandler)
+	a.DELETE("/vote", s.apiCancelVoteHandler)
+	a.PUT("/vote/ballot", s.apiBallotHandler)
+	a.POST("/vote/finish", s.apiFinishVoteHandler)
+	a.POST("/result/ack", s.apiAckResultHandler)
+	a.POST("/policies", s.apiEnactPolicyHandler)
+
+	h := a.Group("/webhooks", s.requireHost)
+	h.GET("", s.apiWebhooksHandler)
+	h.POST("", s.apiAddWebhookHandler)
+	h.DELETE("/:hook", s.apiRemoveWebhookHandler)
+
+	if auth, ok := adminAuth(s.cfg); ok {
+		ad := r.Group("/admin", auth, requireHtmx)
+		ad.GET("", s.adminHandler)
+		ad.GET("/games", s.adminGamesHandler)
+		ad.GET("/games/:id", s.adminGameHandler)
+		ad.GET("/games/:id/state", s.adminGameStateHandler)
+		ad.POST("/games/:id/announce", s.adminAnnounceHandler)
+		ad.POST("/games/:id/players/:player/remove", s.adminRemovePlayerHandler)
+		ad.POST("/games/:id/end", s.adminEndGameHandler)
+	}
+	return e
+}
+
+func (s *Session) Start() {
+	e := s.routes()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var tlsConfig *tls.Config
+	if s.cfg.TLSCert != "" {
+		var err error
+		tlsConfig, err = s.tlsConfig()
+		if err != nil {
+			slog.Error("could not serve https", "err", err)
+			os.Exit(1)
+		}
+	}
+
+	var redirect *http.Server
+	if s.cfg.RedirectAddr != "" {
+		redirect = s.redirectServer()
+		go listenRedirect(redirect)
+	}
+
+	go func() {
+		slog.Info("listening", "addr", s.cfg.Addr, "https", tlsConfig != nil)
+		var err error
+		if tlsConfig != nil {
+			e.TLSServer.Addr = s.cfg.Addr
+			e.TLSServer.TLSConfig = tlsConfig
+			err = e.StartServer(e.TLSServer)
+		} else {
+			err = e.Start(s.cfg.Addr)
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("could not listen", "err", err)
+			os.Exit(1)
+		}
+	}()
+
+	<-ctx.Done()
+	s.shutdown(e, redirect)
+}
+
+// shutdown reports not ready for a while so proxies drain, tells every client to reconnect shortly, waits for the
+// connections to close and saves the games
+func (s *Session) shutdown(e *echo.Echo, redirect *http.Server) {
+	s.draining.Store(true)
+	if d := s.cfg.DrainDelay; d > 0 {
+		slog.Info("draining, interrupt again to skip", "delay", d)
+		again := make(chan os.Signal, 1)
+		signal.Notify(again, os.Interrupt, syscall.SIGTERM)
+		select {
+		case <-time.After(d):
+		case <-again:
+		}
+		signal.Stop(again)
+	}
+
+	slog.Info("shutting down")
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	s.gamePool.Close()
+
+	// saved first, delivering the last webhooks and MQTT messages may take until the process gets killed
+	err := s.saveState()
 	if err != nil {
-		log.Fatalln("could not start to listen to to error ", err)
+		slog.Error("could not save games", "err", err)
+	}
+
+	err = e.Shutdown(ctx)
+	if err != nil {
+		slog.Warn("could not shut down cleanly", "err", err)
+	}
+	if redirect != nil {
+		_ = redirect.Shutdown(ctx)
+	}
+
+	// websockets are hijacked, echo does not wait for them
+	done := make(chan struct{})
+	go func() {
+		s.conns.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		slog.Warn("some connections did not close in time")
+	}
+
+	err = s.webhooks.Close(ctx)
+	if err != nil {
+		slog.Warn("some webhooks could not be delivered in time")
+	}
+
+	if s.mqtt != nil {
+		err = s.mqtt.Close(ctx)
+		if err != nil {
+			slog.Warn("could not disconnect from the MQTT broker in time")
+		}
 	}
 }
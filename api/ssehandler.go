@@ -0,0 +1,37 @@
+package api
+
+import (
+	"errors"
+	"github.com/Neifen/secret-h/socket"
+	"github.com/Neifen/secret-h/view"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+// e.GET("/sse/:id", s.sseHandler)
+// sseHandler streams the same fragments as the websocket, for networks where websockets do not get through
+func (s *Session) sseHandler(c echo.Context) error {
+	gid := c.Param("id")
+	p := currentPlayer(c)
+
+	s.conns.Add(1)
+	defer s.conns.Done()
+	openConnections.Inc("sse")
+	defer openConnections.Dec("sse")
+
+	stream := socket.NewStream(c.Response())
+	disconnect, err := s.gamePool.Connect(gid, p, view.WSSubscriber(stream, p))
+	if err != nil {
+		return c.String(http.StatusNotFound, err.Error())
+	}
+	defer disconnect()
+
+	err = stream.Serve(c.Request().Context(), func() {
+		s.gamePool.PlayerSeen(gid, p)
+	})
+
+	if err != nil && !errors.Is(err, c.Request().Context().Err()) {
+		logger(c).Warn("event stream ended", "err", err)
+	}
+	return nil
+}
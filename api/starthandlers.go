@@ -1,11 +1,11 @@
 package api
 
 import (
-	"fmt"
+	"github.com/Neifen/secret-h/entities"
+	"github.com/Neifen/secret-h/game"
 	"github.com/Neifen/secret-h/view"
 	"github.com/labstack/echo/v4"
 	"net/http"
-	"time"
 )
 
 // e.POST("/start", s.startHandler)
@@ -20,9 +20,9 @@ func (s *Session) startHandler(c echo.Context) error {
 		return view.RenderError(c, err)
 	}
 
-	url := fmt.Sprintf("/lobby/%v/%s", code, p.Uid)
+	url := view.Path("/lobby/%v", code)
 
-	setCookies(c, code, p.Uid)
+	s.setSession(c, code, p)
 	c.Response().Header().Set("HX-Redirect", url) //HX-Redirect to url
 	return c.NoContent(http.StatusOK)
 }
@@ -47,42 +47,62 @@ func (s *Session) joinHandler(c echo.Context) error {
 		return view.RenderError(c, err)
 	}
 
-	url := fmt.Sprintf("/lobby/%v/%s", code, p.Uid)
+	url := view.Path("/lobby/%v", code)
 
-	setCookies(c, code, p.Uid)
+	s.setSession(c, code, p)
 	c.Response().Header().Set("HX-Redirect", url) //HX-Redirect to url
 	return c.NoContent(http.StatusOK)
 }
 
-// e.POST("/leave", s.leaveHandler)
-func (s *Session) leaveHandler(c echo.Context) error {
+// e.GET("/transfer/:id/:token", s.transferHandler)
+func (s *Session) transferHandler(c echo.Context) error {
 	gid := c.Param("id")
-	pid := c.Param("player")
+	token := c.Param("token")
+
+	p, err := s.gamePool.ClaimTransfer(gid, token)
+	if err != nil {
+		return view.RenderViewMessage(c, err.Error())
+	}
 
-	return view.RenderLeavePopup(c, gid, pid)
+	s.setSession(c, gid, p)
+	return c.Redirect(http.StatusSeeOther, view.Path("/lobby/%s", gid))
 }
 
-// e.POST("/leave-confirmed/:id/:player", s.leaveConfirmedHandler)
-func (s *Session) leaveConfirmedHandler(c echo.Context) error {
+// e.POST("/transfer-qr/:id", s.initTransferQrPopup)
+func (s *Session) initTransferQrPopup(c echo.Context) error {
 	gid := c.Param("id")
-	pid := c.Param("player")
 
-	err := s.gamePool.RemoveFromGame(gid, pid, false)
+	token, err := s.gamePool.NewTransfer(gid, currentPlayer(c))
 	if err != nil {
 		return view.RenderError(c, err)
 	}
 
-	setCookies(c, gid, pid)
-	c.Response().Header().Set("HX-Redirect", "/") //HX-Redirect to home
-	return c.NoContent(http.StatusOK)
+	qr, err := game.CreateTransferQr(s.publicBase(c.Request()), gid, token, s.cfg.QRLevel)
+	if err != nil {
+		return view.RenderError(c, err)
+	}
+
+	return view.RenderQRPopup(c, qr, "Scan this with your other device within 2 minutes to continue there")
 }
 
-func setCookies(c echo.Context, gid, pid string) {
-	c.SetCookie(&http.Cookie{Name: "gid", Value: gid, Path: "/"})
-	c.SetCookie(&http.Cookie{Name: "pid", Value: pid, Path: "/"})
+// e.POST("/leave/:id", s.leaveHandler)
+func (s *Session) leaveHandler(c echo.Context) error {
+	gid := c.Param("id")
+
+	return view.RenderLeavePopup(c, gid)
 }
 
-func deleteCookies(c echo.Context) {
-	c.SetCookie(&http.Cookie{Name: "gid", Value: "", Path: "/", Expires: time.Unix(0, 0)})
-	c.SetCookie(&http.Cookie{Name: "pid", Value: "", Path: "/", Expires: time.Unix(0, 0)})
+// e.POST("/leave-confirmed/:id", s.leaveConfirmedHandler)
+func (s *Session) leaveConfirmedHandler(c echo.Context) error {
+	gid := c.Param("id")
+	p := currentPlayer(c)
+
+	err := s.gamePool.RemoveFromGame(gid, p, p.Uid, entities.Left)
+	if err != nil {
+		return view.RenderError(c, err)
+	}
+
+	deleteSession(c)
+	c.Response().Header().Set("HX-Redirect", view.Path("/")) //HX-Redirect to home
+	return c.NoContent(http.StatusOK)
 }
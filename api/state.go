@@ -0,0 +1,85 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Neifen/secret-h/game"
+	"github.com/Neifen/secret-h/webhooks"
+	"log/slog"
+	"os"
+)
+
+// state is written on shutdown and read on the next start. It contains the session key, so the session cookies
+// of the players stay valid.
+type state struct {
+	SessionKey []byte                 `json:"sessionKey"`
+	Games      []game.GameState       `json:"games"`
+	Webhooks   map[string][]savedHook `json:"webhooks,omitempty"` // game code - webhooks of the game
+}
+
+// savedHook is a webhook with its secret, which the api never shows
+type savedHook struct {
+	Id     string `json:"id"`
+	URL    string `json:"url"`
+	Secret string `json:"secret"`
+}
+
+func (s *Session) saveState() error {
+	path := s.cfg.StateFile
+	if path == "" {
+		return nil
+	}
+
+	st := state{SessionKey: s.sessionKey, Games: s.gamePool.Snapshot(), Webhooks: map[string][]savedHook{}}
+	for gid, hooks := range s.webhooks.GameHooks() {
+		for _, h := range hooks {
+			st.Webhooks[gid] = append(st.Webhooks[gid], savedHook{Id: h.Id, URL: h.URL, Secret: h.Secret})
+		}
+	}
+
+	b, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("saving games", "file", path)
+	return os.WriteFile(path, b, 0600)
+}
+
+// loadState restores the games of the last shutdown. The file is removed afterwards, so a crash later on does
+// not bring back old games.
+func (s *Session) loadState() error {
+	path := s.cfg.StateFile
+	if path == "" {
+		return nil
+	}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var st state
+	err = json.Unmarshal(b, &st)
+	if err != nil {
+		return fmt.Errorf("could not read %v: %w", path, err)
+	}
+
+	err = s.gamePool.Restore(st.Games)
+	if err != nil {
+		return err
+	}
+	for gid, hooks := range st.Webhooks {
+		for _, h := range hooks {
+			s.webhooks.Register(gid, webhooks.Hook{Id: h.Id, URL: h.URL, Secret: h.Secret})
+		}
+	}
+	if len(st.SessionKey) > 0 {
+		s.sessionKey = st.SessionKey
+	}
+	return os.Remove(path)
+}
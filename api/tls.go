@@ -0,0 +1,146 @@
+package api
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// certCheckInterval is how often the certificate files are checked for a renewal
+const certCheckInterval = time.Second * 10
+
+// certReloader serves the certificate of the config and loads it again when its files change, so a renewed
+// certificate is used without a restart
+type certReloader struct {
+	certFile string
+	keyFile  string
+	cert     atomic.Pointer[tls.Certificate]
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	go r.watch()
+	return r, nil
+}
+
+func (r *certReloader) load() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("could not load certificate: %w", err)
+	}
+	r.cert.Store(&cert)
+	slog.Info("loaded certificate", "file", r.certFile, "expires", cert.Leaf.NotAfter)
+	return nil
+}
+
+// watch reloads the certificate when either file changed
+func (r *certReloader) watch() {
+	last, _ := r.modTime()
+	for range time.Tick(certCheckInterval) {
+		last = r.check(last)
+	}
+}
+
+// check loads the certificate again if its files changed since last and returns the time of the loaded files.
+// A failed load is tried again on the next check, the files might just be halfway written, until then the old
+// certificate is kept.
+func (r *certReloader) check(last time.Time) time.Time {
+	m, err := r.modTime()
+	if err != nil || m.Equal(last) {
+		return last
+	}
+	if err := r.load(); err != nil {
+		slog.Error("keeping the old certificate", "err", err)
+		return last
+	}
+	return m
+}
+
+// modTime is the time the newer of both files changed
+func (r *certReloader) modTime() (time.Time, error) {
+	var latest time.Time
+	for _, f := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(f)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+func (r *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.cert.Load(), nil
+}
+
+// tlsConfig serves https with the certificate files of the config
+func (s *Session) tlsConfig() (*tls.Config, error) {
+	certs, err := newCertReloader(s.cfg.TLSCert, s.cfg.TLSKey)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{GetCertificate: certs.getCertificate, MinVersion: tls.VersionTLS12}, nil
+}
+
+// hsts tells browsers to only use https for a while, on responses that went over https
+func (s *Session) hsts(next echo.HandlerFunc) echo.HandlerFunc {
+	value := fmt.Sprintf("max-age=%d", int(s.cfg.HSTSMaxAge.Seconds()))
+	return func(c echo.Context) error {
+		if strings.HasPrefix(s.publicBase(c.Request()), "https://") {
+			c.Response().Header().Set("Strict-Transport-Security", value)
+		}
+		return next(c)
+	}
+}
+
+// redirectServer answers plain http on the redirect address with a redirect to the same url over https
+func (s *Session) redirectServer() *http.Server {
+	_, tlsPort, _ := net.SplitHostPort(s.cfg.Addr)
+	return &http.Server{
+		Addr:              s.cfg.RedirectAddr,
+		ReadHeaderTimeout: time.Second * 10,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasPrefix(s.cfg.PublicURL, "https://") {
+				http.Redirect(w, r, strings.TrimSuffix(s.cfg.PublicURL, "/")+r.URL.RequestURI(), http.StatusMovedPermanently)
+				return
+			}
+
+			host := r.Host
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+			}
+			host = strings.Trim(host, "[]")
+			if tlsPort != "443" {
+				host = net.JoinHostPort(host, tlsPort)
+			}
+			if !validHost(host) {
+				http.Error(w, "invalid host", http.StatusBadRequest)
+				return
+			}
+			http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+		}),
+	}
+}
+
+// listenRedirect runs the redirect server until it is shut down
+func listenRedirect(srv *http.Server) {
+	slog.Info("redirecting to https", "addr", srv.Addr)
+	err := srv.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("could not listen for redirects", "err", err)
+		os.Exit(1)
+	}
+}
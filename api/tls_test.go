@@ -0,0 +1,181 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/Neifen/secret-h/config"
+	"github.com/labstack/echo/v4"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRedirectServer(t *testing.T) {
+	tests := []struct {
+		name      string
+		addr      string
+		publicURL string
+		host      string
+		target    string
+		want      string // Location, empty for a bad request
+	}{
+		{
+			name: "same host on the https port", addr: ":8443", host: "games.example.org:8080", target: "/secret-h/lobby/42?join=1",
+			want: "https://games.example.org:8443/secret-h/lobby/42?join=1",
+		},
+		{
+			name: "default port is left out", addr: ":443", host: "games.example.org", target: "/",
+			want: "https://games.example.org/",
+		},
+		{
+			name: "ipv6", addr: ":8443", host: "[::1]:80", target: "/lobby/42",
+			want: "https://[::1]:8443/lobby/42",
+		},
+		{
+			name: "public url wins over the host", addr: ":8443", publicURL: "https://games.example.org/", host: "10.0.0.5", target: "/secret-h/lobby/42?join=1",
+			want: "https://games.example.org/secret-h/lobby/42?join=1",
+		},
+		{
+			name: "invalid host", addr: ":8443", host: "evil.example.org@games.example.org", target: "/",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Session{cfg: config.Config{Addr: tt.addr, PublicURL: tt.publicURL}}
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			req.Host = tt.host
+			rec := httptest.NewRecorder()
+			s.redirectServer().Handler.ServeHTTP(rec, req)
+
+			if tt.want == "" {
+				if rec.Code != http.StatusBadRequest {
+					t.Errorf("status %v, want 400", rec.Code)
+				}
+				return
+			}
+			if rec.Code != http.StatusMovedPermanently || rec.Header().Get("Location") != tt.want {
+				t.Errorf("status %v to %q, want 301 to %q", rec.Code, rec.Header().Get("Location"), tt.want)
+			}
+		})
+	}
+}
+
+func TestHSTS(t *testing.T) {
+	tests := []struct {
+		name      string
+		publicURL string
+		tls       bool
+		want      string
+	}{
+		{name: "plain http", want: ""},
+		{name: "https", tls: true, want: "max-age=3600"},
+		{name: "https at the proxy", publicURL: "https://games.example.org", want: "max-age=3600"},
+		{name: "http at the proxy", publicURL: "http://games.example.org", tls: true, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Session{cfg: config.Config{HSTSMaxAge: time.Hour, PublicURL: tt.publicURL}}
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+			rec := httptest.NewRecorder()
+			err := s.hsts(func(c echo.Context) error {
+				return c.NoContent(http.StatusOK)
+			})(echo.New().NewContext(req, rec))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := rec.Header().Get("Strict-Transport-Security"); got != tt.want {
+				t.Errorf("Strict-Transport-Security %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// writeCert writes a self-signed certificate with the serial number and its key, changed at modified
+func writeCert(t *testing.T, certFile, keyFile string, serial int64, modified time.Time) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "games.example.org"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for file, block := range map[string]*pem.Block{certFile: {Type: "CERTIFICATE", Bytes: der}, keyFile: {Type: "EC PRIVATE KEY", Bytes: keyDer}} {
+		if err := os.WriteFile(file, pem.EncodeToMemory(block), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(file, modified, modified); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCertReloaderPicksUpRotatedCert(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	start := time.Now().Add(-time.Hour)
+	writeCert(t, certFile, keyFile, 1, start)
+
+	r, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial := func() int64 {
+		cert, _ := r.getCertificate(nil)
+		return cert.Leaf.SerialNumber.Int64()
+	}
+	if got := serial(); got != 1 {
+		t.Fatalf("serial %v, want 1", got)
+	}
+
+	last := r.check(start)
+	if got := serial(); got != 1 || !last.Equal(start) {
+		t.Fatalf("unchanged files gave serial %v, time %v", got, last)
+	}
+
+	renewed := start.Add(time.Minute)
+	writeCert(t, certFile, keyFile, 2, renewed)
+	last = r.check(last)
+	if got := serial(); got != 2 || !last.Equal(renewed) {
+		t.Fatalf("renewed files gave serial %v, time %v", got, last)
+	}
+
+	// halfway written, the old certificate stays until the next check
+	if err := os.WriteFile(certFile, []byte("-----BEGIN CERT"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(certFile, renewed.Add(time.Minute), renewed.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	r.check(last)
+	if got := serial(); got != 2 {
+		t.Errorf("serial %v after a broken file, want 2", got)
+	}
+}
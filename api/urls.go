@@ -0,0 +1,96 @@
+package api
+
+import (
+	"github.com/Neifen/secret-h/view"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+)
+
+// publicBase is the url players reach the server at, with the base path and without a trailing slash. The public
+// url of the config wins, otherwise it comes from the request, with the forwarded headers of trusted proxies.
+func (s *Session) publicBase(req *http.Request) string {
+	if s.cfg.PublicURL != "" {
+		return strings.TrimSuffix(s.cfg.PublicURL, "/") + view.Path("")
+	}
+
+	scheme, host := "http", req.Host
+	if req.TLS != nil {
+		scheme = "https"
+	}
+	if s.fromTrustedProxy(req) {
+		proto, fwdHost := forwarded(req.Header)
+		if proto == "http" || proto == "https" {
+			scheme = proto
+		}
+		if validHost(fwdHost) {
+			host = fwdHost
+		}
+	}
+	return scheme + "://" + host + view.Path("")
+}
+
+// fromTrustedProxy tells whether the request comes straight from one of the trusted proxies, anyone else could
+// forge the forwarded headers
+func (s *Session) fromTrustedProxy(req *http.Request) bool {
+	if len(s.proxies) == 0 {
+		return false
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	ip = ip.Unmap()
+	for _, p := range s.proxies {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwarded reads the protocol and host the client asked for, from the standard Forwarded header or else from
+// X-Forwarded-Proto and X-Forwarded-Host. Every proxy appends its entry, so only the last one comes from the trusted
+// proxy, the ones before it could have been sent by the client.
+func forwarded(h http.Header) (proto, host string) {
+	if f := lastEntry(h, "Forwarded"); f != "" {
+		for _, pair := range strings.Split(f, ";") {
+			k, v, _ := strings.Cut(strings.TrimSpace(pair), "=")
+			v = strings.Trim(v, `"`)
+			switch strings.ToLower(k) {
+			case "proto":
+				proto = strings.ToLower(v)
+			case "host":
+				host = v
+			}
+		}
+		return proto, host
+	}
+
+	return strings.ToLower(lastEntry(h, "X-Forwarded-Proto")), lastEntry(h, "X-Forwarded-Host")
+}
+
+// lastEntry returns the last of the comma separated entries of a header, which may also be sent several times
+func lastEntry(h http.Header, name string) string {
+	values := h.Values(name)
+	if len(values) == 0 {
+		return ""
+	}
+	entries := strings.Split(values[len(values)-1], ",")
+	return strings.TrimSpace(entries[len(entries)-1])
+}
+
+// validHost only lets through a host with an optional port, nothing that changes the rest of the url
+func validHost(host string) bool {
+	if host == "" {
+		return false
+	}
+	u, err := url.Parse("http://" + host)
+	return err == nil && u.Host == host && u.User == nil
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestForwarded(t *testing.T) {
+	tests := []struct {
+		name      string
+		header    map[string][]string
+		wantProto string
+		wantHost  string
+	}{
+		{name: "none"},
+		{
+			name:      "forwarded",
+			header:    map[string][]string{"Forwarded": {`for=1.2.3.4;proto=HTTPS;host="games.example.org"`}},
+			wantProto: "https", wantHost: "games.example.org",
+		},
+		{
+			name:      "forwarded by a client and the proxy",
+			header:    map[string][]string{"Forwarded": {`host=evil.example.org;proto=http, for=1.2.3.4;host=games.example.org;proto=https`}},
+			wantProto: "https", wantHost: "games.example.org",
+		},
+		{
+			name:      "forwarded sent twice",
+			header:    map[string][]string{"Forwarded": {"host=evil.example.org", "host=games.example.org"}},
+			wantProto: "", wantHost: "games.example.org",
+		},
+		{
+			name: "forwarded wins over x-forwarded",
+			header: map[string][]string{
+				"Forwarded":        {"proto=https;host=games.example.org"},
+				"X-Forwarded-Host": {"other.example.org"},
+			},
+			wantProto: "https", wantHost: "games.example.org",
+		},
+		{
+			name: "x-forwarded by a client and the proxy",
+			header: map[string][]string{
+				"X-Forwarded-Proto": {"http, HTTPS"},
+				"X-Forwarded-Host":  {"evil.example.org", " games.example.org:8443 "},
+			},
+			wantProto: "https", wantHost: "games.example.org:8443",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			for k, vs := range tt.header {
+				for _, v := range vs {
+					h.Add(k, v)
+				}
+			}
+			proto, host := forwarded(h)
+			if proto != tt.wantProto || host != tt.wantHost {
+				t.Errorf("got %q %q, want %q %q", proto, host, tt.wantProto, tt.wantHost)
+			}
+		})
+	}
+}
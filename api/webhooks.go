@@ -0,0 +1,77 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Neifen/secret-h/config"
+	"github.com/Neifen/secret-h/protocol"
+	"github.com/Neifen/secret-h/webhooks"
+	"github.com/labstack/echo/v4"
+	"log/slog"
+	"net/http"
+	"net/url"
+)
+
+// newDispatcher sets up the webhooks of the whole server, the webhook secret signs their payloads
+func newDispatcher(cfg config.Config) *webhooks.Dispatcher {
+	var hooks []webhooks.Hook
+	for _, u := range cfg.Webhooks {
+		hooks = append(hooks, webhooks.NewHook(u, cfg.WebhookSecret))
+	}
+
+	if len(hooks) > 0 {
+		slog.Info("sending webhooks", "urls", len(hooks))
+	}
+	return webhooks.NewDispatcher(hooks...)
+}
+
+var errWebhooksOff = errors.New("webhooks for single games are turned off on this server")
+
+// requireHost only lets the host of the game manage its webhooks
+func (s *Session) requireHost(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		// off by default, since it makes the server send requests to any url a player chooses
+		if !s.cfg.GameWebhooks {
+			return apiError(c, http.StatusForbidden, protocol.CodeForbidden, errWebhooksOff)
+		}
+
+		g, err := s.gamePool.FindGame(c.Param("id"))
+		if err != nil {
+			return apiGameError(c, err)
+		}
+		if !g.IsHost(currentPlayer(c)) {
+			return apiError(c, http.StatusForbidden, protocol.CodeForbidden, errors.New("only the host can manage webhooks"))
+		}
+		return next(c)
+	}
+}
+
+// e.GET("/api/v1/games/:id/webhooks", s.apiWebhooksHandler)
+func (s *Session) apiWebhooksHandler(c echo.Context) error {
+	return c.JSON(http.StatusOK, s.webhooks.Hooks(c.Param("id")))
+}
+
+// e.POST("/api/v1/games/:id/webhooks", s.apiAddWebhookHandler)
+func (s *Session) apiAddWebhookHandler(c echo.Context) error {
+	var req protocol.WebhookRequest
+	if err := c.Bind(&req); err != nil {
+		return badRequest(c, errInvalidBody)
+	}
+
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return badRequest(c, fmt.Errorf("%q is not a http or https url", req.URL))
+	}
+
+	h := webhooks.NewHook(u.String(), req.Secret)
+	s.webhooks.Register(c.Param("id"), h)
+	return c.JSON(http.StatusCreated, h)
+}
+
+// e.DELETE("/api/v1/games/:id/webhooks/:hook", s.apiRemoveWebhookHandler)
+func (s *Session) apiRemoveWebhookHandler(c echo.Context) error {
+	if !s.webhooks.Unregister(c.Param("id"), c.Param("hook")) {
+		return apiError(c, http.StatusNotFound, protocol.CodeNotFound, fmt.Errorf("webhook %v does not exist", c.Param("hook")))
+	}
+	return c.NoContent(http.StatusNoContent)
+}
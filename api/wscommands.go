@@ -0,0 +1,140 @@
+package api
+
+import (
+	"github.com/Neifen/secret-h/entities"
+	"github.com/Neifen/secret-h/protocol"
+	"github.com/Neifen/secret-h/socket"
+	"github.com/Neifen/secret-h/view"
+	"log/slog"
+)
+
+// replier answers a command on the connection it came from. Everything other players see is sent as event,
+// a replier only sends what the POST handler would have returned.
+type replier interface {
+	ballot(gid, ballot string, candidate *entities.Player)
+	waiting(g *entities.Game, missing []*entities.Player, candidate *entities.Player)
+	vote(gid, ballot string, candidate *entities.Player)
+	closePopup()
+	error(err error)
+}
+
+// htmxReplier answers with the same fragments as the POST handlers
+type htmxReplier struct {
+	ws socket.Client
+}
+
+func (r htmxReplier) ballot(gid, ballot string, candidate *entities.Player) {
+	view.WsRenderVoteButton(r.ws, gid, ballot, candidate)
+}
+
+func (r htmxReplier) waiting(g *entities.Game, missing []*entities.Player, candidate *entities.Player) {
+	view.WSRenderVoteWaitPopup(r.ws, missing, g.Code, candidate.Uid)
+}
+
+func (r htmxReplier) vote(gid, ballot string, candidate *entities.Player) {
+	view.WsRenderVote(r.ws, true, gid, ballot, candidate)
+}
+
+func (r htmxReplier) closePopup() {
+	view.WSClosePopup(r.ws)
+}
+
+func (r htmxReplier) error(err error) {
+	view.WSRenderError(r.ws, err)
+}
+
+// jsonReplier only answers what the events do not tell already
+type jsonReplier struct {
+	ws socket.Client
+}
+
+func (r jsonReplier) ballot(string, string, *entities.Player) {}
+
+func (r jsonReplier) waiting(g *entities.Game, missing []*entities.Player, _ *entities.Player) {
+	r.send(protocol.NewVoteWaiting(g, missing))
+}
+
+func (r jsonReplier) vote(string, string, *entities.Player) {}
+
+func (r jsonReplier) closePopup() {}
+
+func (r jsonReplier) error(err error) {
+	r.send(protocol.NewError(err))
+}
+
+func (r jsonReplier) send(msg protocol.Message) {
+	if err := protocol.Send(r.ws, msg); err != nil {
+		slog.Debug("could not send to websocket", "err", err)
+	}
+}
+
+// wsCommand runs a command player p sent over the websocket, like the matching POST handler would
+func (s *Session) wsCommand(gid string, p *entities.Player, msg []byte, r replier) {
+	cmd, err := protocol.ParseCommand(msg)
+	if err != nil {
+		r.error(err)
+		return
+	}
+
+	err = s.runCommand(gid, p, cmd, r)
+	if err != nil {
+		r.error(err)
+	}
+}
+
+func (s *Session) runCommand(gid string, p *entities.Player, cmd protocol.Command, r replier) error {
+	switch cmd.Type {
+	case protocol.CommandCancelVote:
+		// the vote cancelled event closes the popup
+		return s.gamePool.CancelVote(gid, p)
+	case protocol.CommandAckResult:
+		s.gamePool.AckResult(p)
+		r.closePopup()
+		return nil
+	}
+
+	candidate, err := s.gamePool.FindPlayer(gid, cmd.Candidate)
+	if err != nil {
+		return err
+	}
+
+	switch cmd.Type {
+	case protocol.CommandBallot:
+		err = s.gamePool.MakeVote(gid, candidate, p.Uid, cmd.Ballot)
+		if err != nil {
+			return err
+		}
+		r.ballot(gid, cmd.Ballot, candidate)
+	case protocol.CommandFinishVote:
+		result, err := s.gamePool.FinishVote(gid, p, candidate)
+		if err != nil {
+			return err
+		}
+
+		// a finished vote reaches everyone as event
+		if !result.Finished {
+			g, err := s.gamePool.FindGame(gid)
+			if err != nil {
+				return err
+			}
+			r.waiting(g, result.Empty, candidate)
+		}
+	case protocol.CommandCancelWait:
+		s.gamePool.CancelWait(gid, p)
+
+		g, err := s.gamePool.FindGame(gid)
+		if err != nil {
+			return err
+		}
+		if g.Vote == nil {
+			r.closePopup()
+			return nil
+		}
+		ballot, _ := g.Vote.Votes.Load(p.Uid)
+		if ballot == nil {
+			ballot = ""
+		}
+		r.vote(gid, ballot.(string), g.Vote.DestPlayer)
+	}
+	return nil
+}
@@ -1,56 +1,56 @@
 package api
 
 import (
-	"context"
-	"fmt"
+	"github.com/Neifen/secret-h/protocol"
+	"github.com/Neifen/secret-h/socket"
 	"github.com/Neifen/secret-h/view"
 	"github.com/gorilla/websocket"
 	"github.com/labstack/echo/v4"
-	"net/http"
 )
 
-// e.GET("/ws/:id/:player", s.wsHandler)
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		err := r.Context().Value("error")
-		if err != nil {
-			return false
-		}
-		return true
-	},
-} // use default options
+// formatJSON selects the JSON protocol for a websocket, instead of htmx fragments: /ws/:id?format=json
+const formatJSON = "json"
+
+// e.GET("/ws/:id", s.wsHandler)
+var upgrader = websocket.Upgrader{} // use default options, which only allows same origin requests
+
 func (s *Session) wsHandler(c echo.Context) error {
-	pid := c.Param("player")
 	gid := c.Param("id")
-	_, err := s.gamePool.FindPlayer(gid, pid)
-	if err != nil {
-		r := c.Request().WithContext(context.WithValue(c.Request().Context(), "error", err))
-		c.SetRequest(r)
-	}
+	p := currentPlayer(c)
 
-	conn, err := upgrader.Upgrade(c.Response(), c.Request(), nil)
+	ws, err := upgrader.Upgrade(c.Response(), c.Request(), nil)
 	if err != nil {
 		return view.RenderError(c, err)
 	}
 
-	err = s.gamePool.SetPlayerWS(conn, gid, pid)
-	if err != nil {
-		return view.RenderError(c, err)
+	s.conns.Add(1)
+	defer s.conns.Done()
+	openConnections.Inc("websocket")
+	defer openConnections.Dec("websocket")
+
+	conn := socket.New(ws)
+	sub := view.WSSubscriber(conn, p)
+	var r replier = htmxReplier{ws: conn}
+	if c.QueryParam("format") == formatJSON {
+		sub = protocol.WSSubscriber(conn, p)
+		r = jsonReplier{ws: conn}
 	}
 
-	defer func(conn *websocket.Conn) {
-		err := conn.Close()
-		if err != nil {
-			fmt.Println("Websocket error: ", err.Error())
-		}
-	}(conn)
+	disconnect, err := s.gamePool.Connect(gid, p, sub)
+	if err != nil {
+		conn.Close(websocket.ClosePolicyViolation, err.Error())
+		return nil
+	}
+	defer disconnect()
 
-	for {
-		_, mess, err := conn.ReadMessage()
-		if err != nil {
-			return view.RenderError(c, err)
-		}
+	err = conn.Listen(func() {
+		s.gamePool.PlayerSeen(gid, p)
+	}, func(msg []byte) {
+		s.wsCommand(gid, p, msg, r)
+	})
 
-		fmt.Println("ws message ", string(mess))
+	if err != nil && !websocket.IsCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+		logger(c).Warn("websocket ended", "err", err)
 	}
+	return nil
 }
@@ -0,0 +1,193 @@
+// Package client talks to a running Secret-H server over its JSON api and websocket, for bots and end-to-end tests.
+//
+//	c := client.New("http://localhost:8148")
+//	session, err := c.StartGame(ctx, "Bot")
+//	sub, err := c.Subscribe(ctx)
+//	for ev := range sub.Events() {
+//		switch e := ev.(type) {
+//		case protocol.VoteOpened:
+//			err = sub.Cast(e.Vote.Candidate.Id, "yes")
+//		}
+//	}
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Neifen/secret-h/protocol"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Client acts as one player. It is not safe to start or join games from several goroutines at once, everything
+// else is.
+type Client struct {
+	baseURL string
+	http    *http.Client
+
+	session protocol.Session
+}
+
+// APIError is a request the server refused
+type APIError struct {
+	Status  int
+	Code    string // one of the protocol.Code* constants
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%v (%v %v)", e.Message, e.Status, e.Code)
+}
+
+// New creates a client for the server at baseURL, e.g. http://localhost:8148
+func New(baseURL string) *Client {
+	return &Client{baseURL: strings.TrimSuffix(baseURL, "/"), http: http.DefaultClient}
+}
+
+// WithHTTPClient uses hc for all requests instead of http.DefaultClient
+func (c *Client) WithHTTPClient(hc *http.Client) *Client {
+	c.http = hc
+	return c
+}
+
+// Session is the game and player the client acts as, empty before starting or joining a game
+func (c *Client) Session() protocol.Session {
+	return c.session
+}
+
+// StartGame starts a new game, the client acts as its host from then on
+func (c *Client) StartGame(ctx context.Context, name string) (protocol.Session, error) {
+	return c.newSession(ctx, "/games", name)
+}
+
+// JoinGame joins the game with the code, the client acts as the new player from then on
+func (c *Client) JoinGame(ctx context.Context, code, name string) (protocol.Session, error) {
+	return c.newSession(ctx, "/games/"+url.PathEscape(code)+"/players", name)
+}
+
+func (c *Client) newSession(ctx context.Context, path, name string) (protocol.Session, error) {
+	var s protocol.Session
+	err := c.do(ctx, http.MethodPost, path, protocol.NameRequest{Name: name}, &s)
+	if err != nil {
+		return s, err
+	}
+
+	c.session = s
+	return s, nil
+}
+
+// Game returns the whole state of the game
+func (c *Client) Game(ctx context.Context) (protocol.Hello, error) {
+	var h protocol.Hello
+	err := c.do(ctx, http.MethodGet, c.gamePath(""), nil, &h)
+	return h, err
+}
+
+// Players lists the players in the order they joined
+func (c *Client) Players(ctx context.Context) ([]protocol.Player, error) {
+	var players []protocol.Player
+	err := c.do(ctx, http.MethodGet, c.gamePath("/players"), nil, &players)
+	return players, err
+}
+
+// Leave removes the own player from the game
+func (c *Client) Leave(ctx context.Context) error {
+	return c.Remove(ctx, c.session.Player.Id, protocol.ReasonLeft)
+}
+
+// Remove kicks or kills another player, only the host can. reason is protocol.ReasonKicked or ReasonKilled.
+func (c *Client) Remove(ctx context.Context, playerId, reason string) error {
+	path := c.gamePath("/players/" + url.PathEscape(playerId))
+	if playerId != c.session.Player.Id {
+		path += "?reason=" + url.QueryEscape(reason)
+	}
+	return c.do(ctx, http.MethodDelete, path, nil, nil)
+}
+
+// OpenVote asks everybody whether the candidate should become chancellor, the own player is president
+func (c *Client) OpenVote(ctx context.Context, candidate string) (protocol.Vote, error) {
+	var v protocol.Vote
+	err := c.do(ctx, http.MethodPost, c.gamePath("/vote"), protocol.VoteRequest{Candidate: candidate}, &v)
+	return v, err
+}
+
+// Cast votes "yes" or "no" about the candidate, or takes the vote back with ""
+func (c *Client) Cast(ctx context.Context, candidate, ballot string) (protocol.Vote, error) {
+	var v protocol.Vote
+	err := c.do(ctx, http.MethodPut, c.gamePath("/vote/ballot"), protocol.BallotRequest{Candidate: candidate, Ballot: ballot}, &v)
+	return v, err
+}
+
+// FinishVote ends the vote as president, unless players have not voted yet
+func (c *Client) FinishVote(ctx context.Context, candidate string) (protocol.FinishVote, error) {
+	var fv protocol.FinishVote
+	err := c.do(ctx, http.MethodPost, c.gamePath("/vote/finish"), protocol.VoteRequest{Candidate: candidate}, &fv)
+	return fv, err
+}
+
+// CancelVote cancels the vote as president
+func (c *Client) CancelVote(ctx context.Context) error {
+	return c.do(ctx, http.MethodDelete, c.gamePath("/vote"), nil, nil)
+}
+
+// AckResult dismisses the result of the last vote
+func (c *Client) AckResult(ctx context.Context) error {
+	return c.do(ctx, http.MethodPost, c.gamePath("/result/ack"), nil, nil)
+}
+
+// EnactPolicy counts a policy laid on the board at the table, "liberal" or "fascist", only the host can
+func (c *Client) EnactPolicy(ctx context.Context, policy string) (protocol.Policies, error) {
+	var p protocol.Policies
+	err := c.do(ctx, http.MethodPost, c.gamePath("/policies"), protocol.PolicyRequest{Policy: policy}, &p)
+	return p, err
+}
+
+func (c *Client) gamePath(path string) string {
+	return "/games/" + url.PathEscape(c.session.Game) + path
+}
+
+// do sends a request to the JSON api, the answer is decoded into out unless it is nil
+func (c *Client) do(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+"/api/v1"+path, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.session.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.session.Token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var eb protocol.ErrorBody
+		if err := json.NewDecoder(resp.Body).Decode(&eb); err != nil {
+			return &APIError{Status: resp.StatusCode, Code: protocol.CodeInternal, Message: resp.Status}
+		}
+		return &APIError{Status: resp.StatusCode, Code: eb.Error.Code, Message: eb.Error.Message}
+	}
+
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,284 @@
+package client_test
+
+import (
+	"context"
+	"github.com/Neifen/secret-h/api"
+	"github.com/Neifen/secret-h/client"
+	"github.com/Neifen/secret-h/config"
+	"github.com/Neifen/secret-h/protocol"
+	"github.com/gorilla/websocket"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// handler is shared by all tests, a session sets package wide state such as the base path of the views
+var handler = sync.OnceValue(func() http.Handler {
+	return api.NewSession(config.Config{GameTTL: time.Hour, QRLevel: "medium", LogLevel: "error", LogFormat: "text"}).Handler()
+})
+
+func newServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(handler())
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// next waits for the next event of type T, skipping the others, e.g. presence changes
+func next[T any](t *testing.T, sub *client.Subscription) T {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev, ok := <-sub.Events():
+			if !ok {
+				t.Fatalf("subscription ended: %v", sub.Err())
+			}
+			if e, ok := ev.(T); ok {
+				return e
+			}
+		case <-timeout:
+			var want T
+			t.Fatalf("no %T arrived", want)
+		}
+	}
+}
+
+func TestVote(t *testing.T) {
+	srv := newServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	host := client.New(srv.URL)
+	game, err := host.StartGame(ctx, "Max")
+	if err != nil {
+		t.Fatal(err)
+	}
+	eva := client.New(srv.URL)
+	if _, err := eva.JoinGame(ctx, game.Game, "Eva"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.New(srv.URL).JoinGame(ctx, game.Game, "eva"); err == nil {
+		t.Error("joined with a name that is taken")
+	}
+
+	hostSub, err := host.Subscribe(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hostSub.Close()
+	evaSub, err := eva.Subscribe(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer evaSub.Close()
+
+	hello := next[protocol.Hello](t, evaSub)
+	if hello.Game != game.Game || hello.You.Name != "Eva" || len(hello.Players) != 2 || hello.Vote != nil {
+		t.Fatalf("hello %+v", hello)
+	}
+
+	candidate := eva.Session().Player.Id
+	if _, err := host.OpenVote(ctx, candidate); err != nil {
+		t.Fatal(err)
+	}
+	opened := next[protocol.VoteOpened](t, evaSub)
+	if opened.Vote.President.Name != "Max" || opened.Vote.Candidate.Id != candidate {
+		t.Fatalf("vote opened %+v", opened)
+	}
+
+	// one ballot over the websocket, one over the REST api
+	if err := evaSub.Cast(candidate, "yes"); err != nil {
+		t.Fatal(err)
+	}
+	if ballot := next[protocol.BallotUpdated](t, hostSub); ballot.Player.Name != "Eva" || !ballot.Voted {
+		t.Fatalf("ballot %+v", ballot)
+	}
+	if _, err := host.Cast(ctx, candidate, "yes"); err != nil {
+		t.Fatal(err)
+	}
+
+	fv, err := host.FinishVote(ctx, candidate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fv.Finished || fv.Result == nil || !fv.Result.Success {
+		t.Fatalf("finish %+v", fv)
+	}
+	if finished := next[protocol.VoteFinished](t, evaSub); !finished.Result.Success || len(finished.Result.Yes) != 2 {
+		t.Fatalf("vote finished %+v", finished)
+	}
+
+	if _, err := eva.EnactPolicy(ctx, "liberal"); err == nil {
+		t.Error("enacted a policy without being host")
+	}
+	policies, err := host.EnactPolicy(ctx, "fascist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if enacted := next[protocol.PolicyEnacted](t, evaSub); enacted.Policy != "fascist" || enacted.Policies != policies || policies.Fascist != 1 {
+		t.Fatalf("policy enacted %+v, answered %+v", enacted, policies)
+	}
+
+	if err := eva.Leave(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if left := next[protocol.PlayerLeft](t, hostSub); left.Player.Name != "Eva" || left.Reason != protocol.ReasonLeft {
+		t.Fatalf("player left %+v", left)
+	}
+}
+
+func TestSubscriptionSkipsUnknownMessages(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		_ = ws.WriteJSON(protocol.Message{Version: protocol.Version, Type: "policy_from_the_future", Data: map[string]int{"x": 1}})
+		_ = ws.WriteJSON(protocol.Message{Version: protocol.Version, Type: protocol.TypeVoteCancelled})
+		_, _, _ = ws.ReadMessage()
+	}))
+	defer srv.Close()
+
+	sub, err := client.New(srv.URL).Subscribe(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	select {
+	case ev := <-sub.Events():
+		if _, ok := ev.(protocol.VoteCancelled); !ok {
+			t.Fatalf("got %#v, want the vote cancelled after the unknown message", ev)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event")
+	}
+}
+
+func TestKickedPlayerGetsNothingMore(t *testing.T) {
+	srv := newServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	host := client.New(srv.URL)
+	game, err := host.StartGame(ctx, "Max")
+	if err != nil {
+		t.Fatal(err)
+	}
+	eva := client.New(srv.URL)
+	if _, err := eva.JoinGame(ctx, game.Game, "Eva"); err != nil {
+		t.Fatal(err)
+	}
+	tom := client.New(srv.URL)
+	if _, err := tom.JoinGame(ctx, game.Game, "Tom"); err != nil {
+		t.Fatal(err)
+	}
+
+	hostSub, err := host.Subscribe(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hostSub.Close()
+	evaSub, err := eva.Subscribe(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer evaSub.Close()
+	next[protocol.Hello](t, evaSub)
+
+	if err := host.Remove(ctx, eva.Session().Player.Id, protocol.ReasonKicked); err != nil {
+		t.Fatal(err)
+	}
+	if left := next[protocol.PlayerLeft](t, evaSub); left.Player.Name != "Eva" || left.Reason != protocol.ReasonKicked {
+		t.Fatalf("player left %+v", left)
+	}
+	if _, err := host.OpenVote(ctx, tom.Session().Player.Id); err != nil {
+		t.Fatal(err)
+	}
+	next[protocol.VoteOpened](t, hostSub)
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev, ok := <-evaSub.Events():
+			if !ok {
+				return
+			}
+			if _, ok := ev.(protocol.VoteOpened); ok {
+				t.Fatal("kicked player got the vote")
+			}
+		case <-timeout:
+			t.Fatal("the websocket of the kicked player is still open")
+		}
+	}
+}
+
+func TestInvalidBallotsAreRejected(t *testing.T) {
+	srv := newServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	host := client.New(srv.URL)
+	game, err := host.StartGame(ctx, "Max")
+	if err != nil {
+		t.Fatal(err)
+	}
+	candidate := game.Player.Id
+	if _, err := host.OpenVote(ctx, candidate); err != nil {
+		t.Fatal(err)
+	}
+
+	// the websocket checks ballots when it decodes commands, the button of the browser page sends them as query
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, srv.URL+"/make-vote/"+game.Game+"/"+candidate+"?toggle=maybe", nil)
+	req.Header.Set("Authorization", "Bearer "+game.Token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("status %v, want 400", resp.Status)
+	}
+}
+
+func TestJoiningDuringAVote(t *testing.T) {
+	srv := newServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	host := client.New(srv.URL)
+	game, err := host.StartGame(ctx, "Max")
+	if err != nil {
+		t.Fatal(err)
+	}
+	eva := client.New(srv.URL)
+	if _, err := eva.JoinGame(ctx, game.Game, "Eva"); err != nil {
+		t.Fatal(err)
+	}
+	candidate := eva.Session().Player.Id
+	if _, err := host.OpenVote(ctx, candidate); err != nil {
+		t.Fatal(err)
+	}
+
+	// tom has no ballot yet, the page shows him the vote that is going on
+	tom := client.New(srv.URL)
+	session, err := tom.JoinGame(ctx, game.Game, "Tom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, srv.URL+"/vote/"+game.Game+"/"+candidate, nil)
+	req.Header.Set("Authorization", "Bearer "+session.Token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status %v", resp.Status)
+	}
+}
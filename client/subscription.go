@@ -0,0 +1,151 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/Neifen/secret-h/protocol"
+	"github.com/gorilla/websocket"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Subscription is an open websocket of the player. It receives the events of the game and sends commands,
+// which is faster than the REST api for voting.
+type Subscription struct {
+	ws        *websocket.Conn
+	events    chan any
+	done      chan struct{}
+	closing   chan struct{} // closed by Close, so read stops waiting for someone to take the next event
+	closeOnce sync.Once
+
+	writeMu sync.Mutex
+	err     error
+}
+
+// Subscribe opens a websocket for the game of the client. The first event is always protocol.Hello with the whole
+// state of the game.
+func (c *Client) Subscribe(ctx context.Context) (*Subscription, error) {
+	u, err := url.Parse(c.baseURL)
+	if err != nil {
+		return nil, err
+	}
+	u.Scheme = strings.Replace(u.Scheme, "http", "ws", 1)
+	u.Path += "/ws/" + url.PathEscape(c.session.Game)
+	u.RawQuery = "format=json"
+
+	h := http.Header{}
+	h.Set("Authorization", "Bearer "+c.session.Token)
+
+	ws, resp, err := websocket.DefaultDialer.DialContext(ctx, u.String(), h)
+	if err != nil {
+		if resp != nil {
+			return nil, &APIError{Status: resp.StatusCode, Code: protocol.CodeUnauthorized, Message: "could not open websocket"}
+		}
+		return nil, err
+	}
+
+	s := &Subscription{ws: ws, events: make(chan any, 16), done: make(chan struct{}), closing: make(chan struct{})}
+	go s.read()
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = s.Close()
+		case <-s.done:
+		}
+	}()
+	return s, nil
+}
+
+// Events delivers the messages of the game as values of the protocol package, e.g. protocol.VoteOpened.
+// It is closed when the websocket ends, Err tells why.
+func (s *Subscription) Events() <-chan any {
+	return s.events
+}
+
+// Err is the reason the websocket ended, only valid after Events was closed
+func (s *Subscription) Err() error {
+	return s.err
+}
+
+// Restarting reports whether the subscription ended because the server restarts, subscribe again shortly
+func Restarting(err error) bool {
+	return websocket.IsCloseError(err, websocket.CloseServiceRestart)
+}
+
+func (s *Subscription) read() {
+	defer close(s.done)
+	defer close(s.events)
+
+	for {
+		_, msg, err := s.ws.ReadMessage()
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure) && !errors.Is(err, net.ErrClosed) {
+				s.err = err
+			}
+			return
+		}
+
+		ev, err := protocol.Decode(msg)
+		if errors.Is(err, protocol.ErrUnknownType) {
+			// a newer server, the messages this client knows still work
+			continue
+		}
+		if err != nil {
+			s.err = err
+			_ = s.ws.Close()
+			return
+		}
+
+		select {
+		case s.events <- ev:
+		case <-s.closing:
+			return
+		}
+	}
+}
+
+// Cast votes "yes" or "no" about the candidate, or takes the vote back with ""
+func (s *Subscription) Cast(candidate, ballot string) error {
+	return s.send(protocol.Command{Type: protocol.CommandBallot, Candidate: candidate, Ballot: ballot})
+}
+
+// FinishVote ends the vote as president, protocol.VoteWaiting answers if players have not voted yet
+func (s *Subscription) FinishVote(candidate string) error {
+	return s.send(protocol.Command{Type: protocol.CommandFinishVote, Candidate: candidate})
+}
+
+// CancelVote cancels the vote as president
+func (s *Subscription) CancelVote() error {
+	return s.send(protocol.Command{Type: protocol.CommandCancelVote})
+}
+
+// AckResult dismisses the result of the last vote
+func (s *Subscription) AckResult() error {
+	return s.send(protocol.Command{Type: protocol.CommandAckResult})
+}
+
+func (s *Subscription) send(cmd protocol.Command) error {
+	b, err := json.Marshal(cmd)
+	if err != nil {
+		return err
+	}
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	return s.ws.WriteMessage(websocket.TextMessage, b)
+}
+
+// Close ends the websocket, events that were not taken yet are dropped
+func (s *Subscription) Close() error {
+	s.closeOnce.Do(func() { close(s.closing) })
+
+	s.writeMu.Lock()
+	_ = s.ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	s.writeMu.Unlock()
+
+	return s.ws.Close()
+}
@@ -0,0 +1,337 @@
+// Package config collects the settings of the server. Every setting has a default and can be changed in an optional
+// JSON config file, by an environment variable and by a command line flag, in that order, later ones win.
+//
+// The flag and the key in the config file share a name, e.g. -mqtt-broker and "mqtt-broker". The environment
+// variable is SECRET_H_ followed by the name in upper case with underscores, e.g. SECRET_H_MQTT_BROKER.
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/netip"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// envPrefix starts the environment variable of every setting
+const envPrefix = "SECRET_H_"
+
+// basePathPattern keeps the base path to plain segments, it ends up in links, scripts and styles
+var basePathPattern = regexp.MustCompile(`^(/[A-Za-z0-9._~-]+)+$`)
+
+// QRLevels are the error correction levels of QR codes, higher ones still scan when partly covered but are denser
+var QRLevels = []string{"low", "medium", "high", "highest"}
+
+type Config struct {
+	Addr       string        // address to listen on
+	BasePath   string        // prefix of every path, e.g. /secret-h, empty to serve at the root
+	Assets     string        // directory of the static files
+	GameTTL    time.Duration // games are ended this long after they started
+	QRLevel    string        // one of QRLevels
+	StateFile  string        // keeps games over a restart, empty to not keep them
+	DrainDelay time.Duration // how long to report not ready before shutting down
+
+	TLSCert      string        // certificate file, serves https together with the key
+	TLSKey       string        // key file of the certificate
+	RedirectAddr string        // plain http listener that redirects to https, empty for none
+	HSTSMaxAge   time.Duration // how long browsers should only use https, 0 to not tell them
+
+	PublicURL      string   // where players reach the server, without the base path, taken from the requests if empty
+	TrustedProxies []string // ips and cidrs of proxies whose forwarded headers are believed
+
+	LogLevel  string
+	LogFormat string
+
+	Webhooks      []string // urls that receive the events of every game
+	WebhookSecret string
+	GameWebhooks  bool // lets hosts register webhooks for their game
+
+	MQTTBroker   string
+	MQTTPrefix   string
+	MQTTClientId string
+	MQTTUsername string
+	MQTTPassword string
+
+	AdminUser     string
+	AdminPassword string // the admin pages are off without one
+}
+
+// setting is one entry of the config, secret ones are redacted when the config is printed
+type setting struct {
+	name   string
+	secret bool
+}
+
+// flags defines every setting on a flag set, with the defaults as values
+func flags(c *Config, fs *flag.FlagSet) []setting {
+	var s []setting
+	add := func(name string, secret bool) {
+		s = append(s, setting{name: name, secret: secret})
+	}
+	str := func(p *string, name, value, usage string, secret bool) {
+		fs.StringVar(p, name, value, usage+envHint(name))
+		add(name, secret)
+	}
+	dur := func(p *time.Duration, name string, value time.Duration, usage string) {
+		fs.DurationVar(p, name, value, usage+envHint(name))
+		add(name, false)
+	}
+
+	str(&c.Addr, "addr", ":8148", "address to listen on", false)
+	str(&c.BasePath, "base-path", "", "prefix of every path, e.g. /secret-h, empty to serve at the root", false)
+	str(&c.Assets, "assets", "assets", "directory of the static files", false)
+	dur(&c.GameTTL, "game-ttl", time.Hour*24, "games are ended this long after they started")
+	str(&c.QRLevel, "qr-level", "medium", "error correction of QR codes: "+strings.Join(QRLevels, ", "), false)
+	str(&c.StateFile, "state-file", "secret-h-state.json", "keeps games over a restart, empty to not keep them", false)
+	dur(&c.DrainDelay, "drain-delay", time.Second*5, "how long to report not ready before shutting down")
+
+	str(&c.TLSCert, "tls-cert", "", "certificate file, serves https together with -tls-key", false)
+	str(&c.TLSKey, "tls-key", "", "key file of the certificate", false)
+	str(&c.RedirectAddr, "redirect-addr", "", "address of a plain http listener that redirects to https, e.g. :80", false)
+	dur(&c.HSTSMaxAge, "hsts-max-age", 0, "how long browsers should only use https, e.g. 8760h, 0 to not tell them")
+
+	str(&c.PublicURL, "public-url", "", "url players reach the server at, e.g. https://games.example.org, taken from the requests if empty", false)
+	fs.Var((*listValue)(&c.TrustedProxies), "trusted-proxies", "comma separated ips or cidrs of proxies whose forwarded headers are believed"+envHint("trusted-proxies"))
+	add("trusted-proxies", false)
+
+	str(&c.LogLevel, "log-level", "info", "debug, info, warn or error", false)
+	str(&c.LogFormat, "log-format", "text", "text or json", false)
+
+	fs.Var((*listValue)(&c.Webhooks), "webhooks", "comma separated urls that receive the events of every game"+envHint("webhooks"))
+	add("webhooks", false)
+	str(&c.WebhookSecret, "webhook-secret", "", "signs the webhooks", true)
+	fs.BoolVar(&c.GameWebhooks, "game-webhooks", false, "lets hosts register webhooks for their game"+envHint("game-webhooks"))
+	add("game-webhooks", false)
+
+	str(&c.MQTTBroker, "mqtt-broker", "", "MQTT broker to publish to, e.g. tcp://localhost:1883", false)
+	str(&c.MQTTPrefix, "mqtt-prefix", "secret-h", "prefix of the MQTT topics", false)
+	str(&c.MQTTClientId, "mqtt-client-id", "secret-h", "MQTT client id", false)
+	str(&c.MQTTUsername, "mqtt-username", "", "MQTT user", false)
+	str(&c.MQTTPassword, "mqtt-password", "", "MQTT password", true)
+
+	str(&c.AdminUser, "admin-user", "admin", "user of the admin pages", false)
+	str(&c.AdminPassword, "admin-password", "", "password of the admin pages, they are off without one", true)
+	return s
+}
+
+// Load reads the config file given by -config or SECRET_H_CONFIG, then the environment, then the flags in args
+func Load(args []string, output io.Writer) (Config, error) {
+	var c Config
+	fs := flag.NewFlagSet("secret-h", flag.ContinueOnError)
+	fs.SetOutput(output)
+	file := fs.String("config", os.Getenv(envPrefix+"CONFIG"), "optional JSON config file"+envHint("config"))
+	settings := flags(&c, fs)
+
+	// flags win, but they are parsed first to find the config file and remembered to apply them again at the end
+	if err := fs.Parse(args); err != nil {
+		return c, err
+	}
+	if fs.NArg() > 0 {
+		return c, fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+	given := map[string]string{}
+	fs.Visit(func(f *flag.Flag) {
+		given[f.Name] = f.Value.String()
+	})
+
+	if *file != "" {
+		if err := loadFile(fs, *file); err != nil {
+			return c, err
+		}
+	}
+
+	for _, s := range settings {
+		if v, ok := os.LookupEnv(envName(s.name)); ok {
+			if err := fs.Set(s.name, v); err != nil {
+				return c, fmt.Errorf("invalid %v: %w", envName(s.name), err)
+			}
+		}
+	}
+
+	for name, v := range given {
+		_ = fs.Set(name, v)
+	}
+
+	// "/" and "/secret-h/" mean the same as "" and "/secret-h", links are joined to it with their own slash
+	c.BasePath = strings.TrimRight(c.BasePath, "/")
+	return c, c.validate()
+}
+
+// loadFile applies a JSON object of setting names and values
+func loadFile(fs *flag.FlagSet, path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not read config file: %w", err)
+	}
+
+	var values map[string]any
+	if err := json.Unmarshal(b, &values); err != nil {
+		return fmt.Errorf("invalid config file %v: %w", path, err)
+	}
+
+	for name, v := range values {
+		if name == "config" || fs.Lookup(name) == nil {
+			return fmt.Errorf("unknown setting %q in %v", name, path)
+		}
+
+		var s string
+		switch v := v.(type) {
+		case string:
+			s = v
+		case bool:
+			s = strconv.FormatBool(v)
+		case float64:
+			s = strconv.FormatFloat(v, 'f', -1, 64)
+		case []any:
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = fmt.Sprint(item)
+			}
+			s = strings.Join(items, ",")
+		default:
+			return fmt.Errorf("invalid value for %q in %v", name, path)
+		}
+
+		if err := fs.Set(name, s); err != nil {
+			return fmt.Errorf("invalid %q in %v: %w", name, path, err)
+		}
+	}
+	return nil
+}
+
+func (c Config) validate() error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		return fmt.Errorf("invalid log-level %q", c.LogLevel)
+	}
+	if c.LogFormat != "text" && c.LogFormat != "json" {
+		return fmt.Errorf("invalid log-format %q, use text or json", c.LogFormat)
+	}
+	if !slices.Contains(QRLevels, c.QRLevel) {
+		return fmt.Errorf("invalid qr-level %q, use one of %v", c.QRLevel, strings.Join(QRLevels, ", "))
+	}
+	if c.GameTTL <= 0 {
+		return errors.New("game-ttl has to be positive")
+	}
+	if c.BasePath != "" && !basePathPattern.MatchString(c.BasePath) {
+		return fmt.Errorf("invalid base-path %q, use e.g. /secret-h", c.BasePath)
+	}
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		return errors.New("tls-cert and tls-key have to be set together")
+	}
+	if c.RedirectAddr != "" && c.TLSCert == "" {
+		return errors.New("redirect-addr needs tls-cert and tls-key")
+	}
+	if c.HSTSMaxAge < 0 {
+		return errors.New("hsts-max-age cannot be negative")
+	}
+	if c.PublicURL != "" {
+		u, err := url.Parse(c.PublicURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+			return fmt.Errorf("invalid public-url %q, use e.g. https://games.example.org", c.PublicURL)
+		}
+	}
+	if _, err := ParsePrefixes(c.TrustedProxies); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Redacted lists every setting for slog, with secrets hidden and urls cut to their scheme and host
+func (c Config) Redacted() []any {
+	// the flags point into shown, which gets the values only after they are defined with the defaults
+	var shown Config
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	settings := flags(&shown, fs)
+	shown = c
+
+	attrs := make([]any, 0, len(settings))
+	for _, s := range settings {
+		v := fs.Lookup(s.name).Value.String()
+		switch {
+		case s.secret && v != "":
+			v = "[redacted]"
+		case strings.Contains(v, "://"):
+			v = redactURLs(v)
+		}
+		attrs = append(attrs, slog.String(s.name, v))
+	}
+	return attrs
+}
+
+// ParsePrefixes reads ips and cidrs, a single ip is a prefix of only itself
+func ParsePrefixes(items []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(items))
+	for _, item := range items {
+		if strings.Contains(item, "/") {
+			p, err := netip.ParsePrefix(item)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", item, err)
+			}
+			prefixes = append(prefixes, p.Masked())
+			continue
+		}
+
+		ip, err := netip.ParseAddr(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", item, err)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(ip.Unmap(), ip.Unmap().BitLen()))
+	}
+	return prefixes, nil
+}
+
+// redactURLs cuts comma separated urls to their scheme and host, webhooks often carry a token in the path or query
+// and the password of a broker sits in the user info
+func redactURLs(v string) string {
+	parts := strings.Split(v, ",")
+	for i, p := range parts {
+		u, err := url.Parse(p)
+		if err != nil || u.Host == "" {
+			parts[i] = "[redacted]"
+			continue
+		}
+		parts[i] = u.Scheme + "://" + u.Host
+		if u.User != nil {
+			parts[i] = u.Scheme + "://[redacted]@" + u.Host
+		}
+		if strings.Trim(u.Path, "/") != "" || u.RawQuery != "" || u.Fragment != "" {
+			parts[i] += "/[redacted]"
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+func envName(name string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+func envHint(name string) string {
+	return fmt.Sprintf(" (%v)", envName(name))
+}
+
+// listValue is a comma separated flag, setting it replaces the whole list
+type listValue []string
+
+func (l *listValue) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listValue) Set(v string) error {
+	*l = nil
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
@@ -3,9 +3,15 @@ package entities
 import (
 	"fmt"
 	"github.com/google/uuid"
-	"github.com/gorilla/websocket"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 type Game struct {
@@ -13,12 +19,19 @@ type Game struct {
 	Players   *sync.Map // string - *Player
 	Vote      *Vote
 	CreatedAt time.Time
+
+	names sync.Mutex // held from checking a name until it is used, so two players cannot take the same one
+
+	board    sync.Mutex
+	policies Policies // laid on the board of the table
+
+	hostMu  sync.Mutex
+	hostUid string // creator of the game, or whoever it was handed to
 }
 
 func NewGame(code string) *Game {
 	players := &sync.Map{}
 
-	fmt.Printf("New game created with code %v\n", code)
 	return &Game{Code: code, Players: players, CreatedAt: time.Now()}
 }
 
@@ -32,20 +45,119 @@ type VoteResult struct {
 }
 
 type Player struct {
-	Uid  string
-	Name string
-	Ws   *websocket.Conn
+	Uid         string
+	Connections atomic.Int32 // open websockets of the player
+	JoinedAt    time.Time
+
+	mu            sync.Mutex
+	name          string      // changes with RenamePlayer while others read it
+	sessionId     string      // part of the session cookie, changes when the player moves to another device
+	transfer      *Transfer   // pending move to another device
+	pendingResult *VoteResult // last vote result, until the player dismissed it
+
+	lastSeen   atomic.Int64 // unix nanoseconds of the last sign of life on the websocket
+	presenceMu sync.Mutex
+	presence   Presence // presence the other players were last told about, empty counts as offline
 }
 
-func NewPlayer(name string) (*Player, error) {
+// Transfer allows a player to continue on another device, once and for a short time
+type Transfer struct {
+	Token     string
+	ExpiresAt time.Time
+}
+
+type Presence string
+
+const (
+	Online  Presence = "online"
+	Away    Presence = "away"
+	Offline Presence = "offline"
+)
+
+// AwayAfter is how long a connected player can stay silent before being shown as away
+const AwayAfter = time.Second * 25
+
+// Seen records a sign of life at t, the websockets and event streams of a player report from their own goroutines
+func (p *Player) Seen(t time.Time) {
+	p.lastSeen.Store(t.UnixNano())
+}
+
+// LastSeen is the last sign of life of the player
+func (p *Player) LastSeen() time.Time {
+	return time.Unix(0, p.lastSeen.Load())
+}
+
+// CurrentPresence derives the presence from the websocket and the last sign of life
+func (p *Player) CurrentPresence() Presence {
+	if p.Connections.Load() == 0 {
+		return Offline
+	}
+	if time.Since(p.LastSeen()) > AwayAfter {
+		return Away
+	}
+	return Online
+}
+
+// UpdatePresence calls announce when the presence changed since the last announcement. Connections, keepalives
+// and the presence watch update it concurrently, the lock makes sure every change is announced once and in order.
+func (p *Player) UpdatePresence(announce func(Presence)) {
+	p.presenceMu.Lock()
+	defer p.presenceMu.Unlock()
+
+	announced := p.presence
+	if announced == "" {
+		announced = Offline
+	}
+	presence := p.CurrentPresence()
+	if presence == announced {
+		return
+	}
+	p.presence = presence
+	announce(presence)
+}
+
+// MaxNameLength is the maximum number of characters in a player name
+const MaxNameLength = 20
+
+// CleanName trims and normalises a player name and checks whether it can be used
+func CleanName(name string) (string, error) {
+	name = norm.NFC.String(strings.Join(strings.Fields(name), " "))
 	if len(name) == 0 {
-		return nil, fmt.Errorf("cannot create new DestPlayer with empty name\n")
+		return "", fmt.Errorf("name cannot be empty")
+	}
+
+	if utf8.RuneCountInString(name) > MaxNameLength {
+		return "", fmt.Errorf("name cannot be longer than %v characters", MaxNameLength)
+	}
+
+	for _, r := range name {
+		if !unicode.IsPrint(r) {
+			return "", fmt.Errorf("name contains characters that cannot be shown")
+		}
+	}
+	return name, nil
+}
+
+func NewPlayer(name string) (*Player, error) {
+	name, err := CleanName(name)
+	if err != nil {
+		return nil, err
 	}
 
 	uid := uuid.NewString()
+	return &Player{Uid: uid, name: name, JoinedAt: time.Now(), sessionId: uuid.NewString()}, nil
+}
+
+// RestorePlayer brings back a player as they were saved, see NewPlayer for new ones
+func RestorePlayer(uid, name, sessionId string, joinedAt time.Time) *Player {
+	return &Player{Uid: uid, name: name, JoinedAt: joinedAt, sessionId: sessionId}
+}
 
-	fmt.Printf("New DestPlayer created with uid %v and name %v\n", uid, name)
-	return &Player{Uid: uid, Name: name, Ws: nil}, nil
+// Name is the current name of the player, see Game.RenamePlayer
+func (p *Player) Name() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.name
 }
 
 type Vote struct {
@@ -61,7 +173,215 @@ func (g *Game) AddPlayer(name string) (*Player, error) {
 		return nil, err
 	}
 
+	g.names.Lock()
+	defer g.names.Unlock()
+	if g.NameTaken(p.Name(), p) {
+		return nil, fmt.Errorf("there is already a player called %v in this game", p.Name())
+	}
+
 	g.Players.Store(p.Uid, p)
-	fmt.Printf("%v added to game %v\n", p.Name, g.Code)
 	return p, nil
 }
+
+// PendingResult is the result of the last vote, until the player dismissed it
+func (p *Player) PendingResult() *VoteResult {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.pendingResult
+}
+
+func (p *Player) SetPendingResult(r *VoteResult) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pendingResult = r
+}
+
+// SessionId is compared with the session of every request of the player
+func (p *Player) SessionId() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.sessionId
+}
+
+// OfferTransfer replaces the pending transfer of the player
+func (p *Player) OfferTransfer(t *Transfer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.transfer = t
+}
+
+// ClaimTransfer uses up the pending transfer if it has the token. Unless it has expired, the player gets a new
+// session, which logs out the old device. Only one of several devices claiming the same token succeeds.
+func (p *Player) ClaimTransfer(token string) (claimed, expired bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.transfer == nil || p.transfer.Token != token {
+		return false, false
+	}
+
+	t := p.transfer
+	p.transfer = nil
+	if t.ExpiresAt.Before(time.Now()) {
+		return true, true
+	}
+	p.sessionId = uuid.NewString()
+	return true, false
+}
+
+// RenamePlayer gives p a new name, which has to be cleaned already, and returns the old one
+func (g *Game) RenamePlayer(p *Player, name string) (string, error) {
+	g.names.Lock()
+	defer g.names.Unlock()
+	if g.NameTaken(name, p) {
+		return "", fmt.Errorf("there is already a player called %v in this game", name)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	oldName := p.name
+	p.name = name
+	return oldName, nil
+}
+
+// Removal is the reason a player is no longer part of a game
+type Removal int
+
+const (
+	Left Removal = iota
+	Killed
+	Kicked
+	Removed // by the operator of the server
+)
+
+func (r Removal) String() string {
+	switch r {
+	case Killed:
+		return "killed"
+	case Kicked:
+		return "kicked"
+	case Removed:
+		return "removed"
+	default:
+		return "left"
+	}
+}
+
+// MissingVotes lists the players that have not voted yet in the ongoing vote
+func (g *Game) MissingVotes() []*Player {
+	var empty []*Player
+	for _, p := range g.PlayerList() {
+		toggled, _ := g.Vote.Votes.Load(p.Uid)
+		if toggled == nil || toggled == "" {
+			empty = append(empty, p)
+		}
+	}
+	return empty
+}
+
+// PlayerList returns all players in the order they joined
+func (g *Game) PlayerList() []*Player {
+	var players []*Player
+	g.Players.Range(func(_, v interface{}) bool {
+		players = append(players, v.(*Player))
+		return true
+	})
+
+	sort.Slice(players, func(i, j int) bool {
+		return players[i].JoinedAt.Before(players[j].JoinedAt)
+	})
+	return players
+}
+
+func (g *Game) IsHost(p *Player) bool {
+	return g.HostUid() == p.Uid
+}
+
+func (g *Game) HostUid() string {
+	g.hostMu.Lock()
+	defer g.hostMu.Unlock()
+	return g.hostUid
+}
+
+// SetHost hands the host role to the player with uid
+func (g *Game) SetHost(uid string) {
+	g.hostMu.Lock()
+	defer g.hostMu.Unlock()
+	g.hostUid = uid
+}
+
+// nameKey is the same for names that look alike: compatibility forms like fullwidth letters are mapped to
+// their plain ones and case is ignored
+func nameKey(name string) string {
+	return norm.NFKC.String(cases.Fold().String(norm.NFKC.String(name)))
+}
+
+// NameTaken reports whether another player than except already uses a name that looks the same, see nameKey
+func (g *Game) NameTaken(name string, except *Player) bool {
+	key := nameKey(name)
+	taken := false
+	g.Players.Range(func(_, v interface{}) bool {
+		p := v.(*Player)
+		if p != except && nameKey(p.Name()) == key {
+			taken = true
+			return false
+		}
+		return true
+	})
+	return taken
+}
+
+// Policy is a card laid on the board at the table, the app only counts them
+type Policy string
+
+const (
+	Liberal Policy = "liberal"
+	Fascist Policy = "fascist"
+)
+
+// The board has room for this many policies of each kind
+const (
+	MaxLiberal = 5
+	MaxFascist = 6
+)
+
+// Policies counts the policies on the board
+type Policies struct {
+	Liberal int
+	Fascist int
+}
+
+// Policies returns how many policies are on the board
+func (g *Game) Policies() Policies {
+	g.board.Lock()
+	defer g.board.Unlock()
+	return g.policies
+}
+
+// SetPolicies puts the counts on the board, e.g. when a game is restored
+func (g *Game) SetPolicies(p Policies) {
+	g.board.Lock()
+	defer g.board.Unlock()
+	g.policies = p
+}
+
+// Enact lays a policy on the board and returns the new counts
+func (g *Game) Enact(policy Policy) (Policies, error) {
+	g.board.Lock()
+	defer g.board.Unlock()
+
+	switch policy {
+	case Liberal:
+		if g.policies.Liberal >= MaxLiberal {
+			return g.policies, fmt.Errorf("all %v liberal policies are enacted already", MaxLiberal)
+		}
+		g.policies.Liberal++
+	case Fascist:
+		if g.policies.Fascist >= MaxFascist {
+			return g.policies, fmt.Errorf("all %v fascist policies are enacted already", MaxFascist)
+		}
+		g.policies.Fascist++
+	default:
+		return g.policies, fmt.Errorf("unknown policy %q, use liberal or fascist", policy)
+	}
+	return g.policies, nil
+}
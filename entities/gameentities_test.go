@@ -0,0 +1,88 @@
+package entities
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCleanName(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{name: "plain", in: "Max", want: "Max"},
+		{name: "spaces are collapsed", in: "  Max   Muster ", want: "Max Muster"},
+		{name: "composed", in: "José", want: "José"},
+		{name: "empty", in: "   ", wantErr: true},
+		{name: "too long", in: "abcdefghijklmnopqrstu", wantErr: true},
+		{name: "longest", in: "abcdefghijklmnopqrst", want: "abcdefghijklmnopqrst"},
+		{name: "control character", in: "Max\u0007", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CleanName(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CleanName(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("CleanName(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNameTaken(t *testing.T) {
+	g := NewGame("12345")
+	if _, err := g.AddPlayer("Max"); err != nil {
+		t.Fatal(err)
+	}
+	eva, err := g.AddPlayer("Straße")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		except *Player
+		want   bool
+	}{
+		{name: "Max", want: true},
+		{name: "MAX", want: true},
+		{name: "Ｍａｘ", want: true},   // fullwidth letters
+		{name: "Max ", want: false}, // names are cleaned before, this is not one
+		{name: "Mia", want: false},
+		{name: "STRASSE", want: true},
+		{name: "strasse", except: eva, want: false}, // renaming yourself
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := g.NameTaken(tt.name, tt.except); got != tt.want {
+				t.Errorf("NameTaken(%q) = %v, want %v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddPlayerConcurrently(t *testing.T) {
+	g := NewGame("12345")
+
+	var wg sync.WaitGroup
+	var added atomic.Int32
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := g.AddPlayer("Max"); err == nil {
+				added.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if added.Load() != 1 {
+		t.Errorf("%v players called Max joined, want 1", added.Load())
+	}
+}
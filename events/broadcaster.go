@@ -0,0 +1,48 @@
+package events
+
+import (
+	"sync"
+)
+
+// Subscriber receives the events of a game. It is called synchronously by Publish, so it must not block.
+type Subscriber func(ev Event)
+
+// Broadcaster hands the events of one game to all of its subscribers
+type Broadcaster struct {
+	mu   sync.RWMutex
+	subs map[int]Subscriber
+	next int
+}
+
+func NewBroadcaster() *Broadcaster {
+	return &Broadcaster{subs: make(map[int]Subscriber)}
+}
+
+// Subscribe adds a subscriber until the returned function is called
+func (b *Broadcaster) Subscribe(sub Subscriber) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := b.next
+	b.next++
+	b.subs[id] = sub
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subs, id)
+	}
+}
+
+func (b *Broadcaster) Publish(ev Event) {
+	b.mu.RLock()
+	subs := make([]Subscriber, 0, len(b.subs))
+	for _, sub := range b.subs {
+		subs = append(subs, sub)
+	}
+	b.mu.RUnlock()
+
+	for _, sub := range subs {
+		sub(ev)
+	}
+}
@@ -0,0 +1,125 @@
+package events
+
+import (
+	"github.com/Neifen/secret-h/entities"
+	"time"
+)
+
+// Event is something that happened in a game
+type Event interface {
+	Source() Meta
+}
+
+// Meta is part of every event
+type Meta struct {
+	Game *entities.Game
+	At   time.Time
+}
+
+func (m Meta) Source() Meta {
+	return m
+}
+
+// In creates the Meta for an event happening right now in the game
+func In(g *entities.Game) Meta {
+	return Meta{Game: g, At: time.Now()}
+}
+
+// Connected is only delivered to the subscriber of a new connection of the player, so it can catch up
+type Connected struct {
+	Meta
+	Player *entities.Player
+}
+
+type PlayerJoined struct {
+	Meta
+	Player *entities.Player
+}
+
+type PlayerLeft struct {
+	Meta
+	Player *entities.Player
+	Reason entities.Removal
+}
+
+type PlayerRenamed struct {
+	Meta
+	Player  *entities.Player
+	OldName string
+}
+
+type HostChanged struct {
+	Meta
+	Host *entities.Player
+}
+
+type PresenceChanged struct {
+	Meta
+	Player   *entities.Player
+	Presence entities.Presence
+}
+
+// PlayerMoved means the player continues on another device, all current connections of the player are outdated
+type PlayerMoved struct {
+	Meta
+	Player *entities.Player
+}
+
+type VoteOpened struct {
+	Meta
+	Vote *entities.Vote
+}
+
+// BallotCast is sent whenever a player changes their vote, an empty ballot means the vote was taken back
+type BallotCast struct {
+	Meta
+	Vote   *entities.Vote
+	Player *entities.Player
+	Ballot string
+}
+
+type VoteFinished struct {
+	Meta
+	Result *entities.VoteResult
+}
+
+type VoteCancelled struct {
+	Meta
+}
+
+// PolicyEnacted is a policy laid on the board at the table, Policies are the counts including it
+type PolicyEnacted struct {
+	Meta
+	Policy   entities.Policy
+	Policies entities.Policies
+}
+
+// Announcement is a message from the operator of the server to everybody in the game
+type Announcement struct {
+	Meta
+	Text string
+}
+
+// ServerRestarting is sent to every game when the server shuts down, clients should reconnect shortly
+type ServerRestarting struct {
+	Meta
+}
+
+// GameCreated is only delivered to observers of the whole pool, nobody can be subscribed to a new game yet
+type GameCreated struct {
+	Meta
+	Host *entities.Player
+}
+
+// Why a game ended
+const (
+	EndedEmpty = "empty" // the last player left
+	EndedStale = "stale" // the game ran out of time
+	EndedAdmin = "ended" // the operator of the server ended it
+)
+
+// GameEnded is the last event of a game, it is only delivered to observers of the whole pool
+type GameEnded struct {
+	Meta
+	Reason string
+}
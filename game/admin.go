@@ -0,0 +1,112 @@
+package game
+
+import (
+	"github.com/Neifen/secret-h/entities"
+	"github.com/Neifen/secret-h/events"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MaxAnnouncementLength is the longest message the operator can send to a game
+const MaxAnnouncementLength = 200
+
+// Phases of a game
+const (
+	PhaseLobby  = "lobby"
+	PhaseVoting = "voting"
+)
+
+// GameInfo is what the operator of the server sees of a game in the list of all games
+type GameInfo struct {
+	Code      string
+	CreatedAt time.Time
+	Players   int
+	Phase     string
+	Sockets   int // open websockets and event streams of all players
+}
+
+func (i GameInfo) Age() time.Duration {
+	return time.Since(i.CreatedAt).Truncate(time.Second)
+}
+
+// Overview lists all running games, the newest first
+func (gp *GamePool) Overview() []GameInfo {
+	var infos []GameInfo
+	gp.Games.Range(func(_, value interface{}) bool {
+		g := value.(*entities.Game)
+		info := GameInfo{Code: g.Code, CreatedAt: g.CreatedAt, Phase: Phase(g)}
+		for _, p := range g.PlayerList() {
+			info.Players++
+			info.Sockets += int(p.Connections.Load())
+		}
+		infos = append(infos, info)
+		return true
+	})
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].CreatedAt.After(infos[j].CreatedAt)
+	})
+	return infos
+}
+
+// Phase tells what is going on in a game
+func Phase(g *entities.Game) string {
+	if g.Vote != nil {
+		return PhaseVoting
+	}
+	return PhaseLobby
+}
+
+// Announce shows a message of the operator to everybody in the game
+func (gp *GamePool) Announce(code, text string) error {
+	g, err := gp.FindGame(code)
+	if err != nil {
+		return err
+	}
+
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return errorf(Invalid, "the message cannot be empty")
+	}
+	if len([]rune(text)) > MaxAnnouncementLength {
+		return errorf(Invalid, "the message cannot be longer than %v characters", MaxAnnouncementLength)
+	}
+
+	slog.Info("announcement", "game", code)
+	gp.publish(events.Announcement{Meta: events.In(g), Text: text})
+	return nil
+}
+
+// RemoveByOperator takes a player out of the game without asking the host, e.g. one that is stuck
+func (gp *GamePool) RemoveByOperator(code, playerId string) error {
+	g, err := gp.FindGame(code)
+	if err != nil {
+		return err
+	}
+	p, err := gp.FindPlayer(code, playerId)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("player removed", "game", code, "player", p.Uid, "reason", entities.Removed, "by", "operator")
+	gp.removePlayer(g, p, entities.Removed)
+	return nil
+}
+
+// EndGame removes every player and ends the game
+func (gp *GamePool) EndGame(code string) error {
+	g, err := gp.FindGame(code)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("game ended by operator", "game", code)
+	for _, p := range g.PlayerList() {
+		g.Players.Delete(p.Uid)
+		gp.publish(events.PlayerLeft{Meta: events.In(g), Player: p, Reason: entities.Removed})
+	}
+	gp.deleteGame(g, events.EndedAdmin)
+	return nil
+}
@@ -0,0 +1,46 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Kind classifies the errors of the game pool, so an API can answer with a fitting status
+type Kind int
+
+const (
+	Internal Kind = iota
+	NotFound
+	Forbidden
+	Conflict
+	Invalid
+	Unavailable
+)
+
+// Error is an error of the game pool with a message meant for players
+type Error struct {
+	Kind Kind
+	msg  string
+}
+
+func (e *Error) Error() string {
+	return e.msg
+}
+
+func errorf(kind Kind, format string, a ...any) error {
+	return &Error{Kind: kind, msg: fmt.Sprintf(format, a...)}
+}
+
+// invalid marks an error of the entities, which are all about invalid input, as Invalid
+func invalid(err error) error {
+	return &Error{Kind: Invalid, msg: err.Error()}
+}
+
+// KindOf returns the kind of an error, Internal if it does not come from the game pool
+func KindOf(err error) Kind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	return Internal
+}
@@ -1,46 +1,71 @@
 package game
 
 import (
-	"fmt"
 	"github.com/Neifen/secret-h/entities"
-	"github.com/Neifen/secret-h/view"
-	"github.com/gorilla/websocket"
+	"github.com/Neifen/secret-h/events"
+	"log/slog"
 	"math/rand"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type GamePool struct {
-	Games *sync.Map // string - *entities.Game
+	Games        *sync.Map // string - *entities.Game
+	broadcasters *sync.Map // string - *events.Broadcaster
+	observers    *events.Broadcaster
+	closing      atomic.Bool
+	ttl          time.Duration // games are ended this long after they started
 }
 
-func NewGamePool() *GamePool {
-	gp := &GamePool{&sync.Map{}}
+func NewGamePool(ttl time.Duration) *GamePool {
+	gp := &GamePool{Games: &sync.Map{}, broadcasters: &sync.Map{}, observers: events.NewBroadcaster(), ttl: ttl}
 
 	go gp.watchdog()
+	go gp.presenceWatch()
 
 	return gp
 }
 
 func (gp *GamePool) watchdog() {
+	// short lived games are checked more often, so they do not live much longer than they should
+	interval := min(time.Hour, gp.ttl/4)
 	for {
 		i := 0
 		gp.Games.Range(func(key, value interface{}) bool {
 			g := value.(*entities.Game)
-			if g.CreatedAt.Add(time.Hour * 24).Before(time.Now()) {
-				fmt.Printf("Games stale: %v\n", key)
-				gp.Games.Delete(key)
+			if g.CreatedAt.Add(gp.ttl).Before(time.Now()) {
+				slog.Info("game stale", "game", key)
+				gp.deleteGame(g, events.EndedStale)
 				i--
 			}
 			i++
 			return true
 		})
-		fmt.Printf("Games running: %v\n", i)
-		time.Sleep(time.Hour)
+		slog.Debug("games running", "count", i)
+		time.Sleep(interval)
 	}
 }
 
+// Accepting tells whether new games can be started, which stops when the pool closes
+func (gp *GamePool) Accepting() bool {
+	return !gp.closing.Load()
+}
+
+// Count returns how many games are running and how many players are in them
+func (gp *GamePool) Count() (games, players int) {
+	gp.Games.Range(func(_, value interface{}) bool {
+		games++
+		value.(*entities.Game).Players.Range(func(_, _ interface{}) bool {
+			players++
+			return true
+		})
+		return true
+	})
+	return games, players
+}
+
 func (gp *GamePool) NewVote(gid string, origin *entities.Player, dest *entities.Player) (*entities.Vote, error) {
 	g, err := gp.FindGame(gid)
 	if err != nil {
@@ -48,7 +73,7 @@ func (gp *GamePool) NewVote(gid string, origin *entities.Player, dest *entities.
 	}
 
 	if g.Vote != nil {
-		return g.Vote, fmt.Errorf("vote already exists")
+		return g.Vote, errorf(Conflict, "vote already exists")
 	}
 
 	votes := &sync.Map{}
@@ -58,15 +83,7 @@ func (gp *GamePool) NewVote(gid string, origin *entities.Player, dest *entities.
 	})
 
 	g.Vote = &entities.Vote{OriginPlayer: origin, DestPlayer: dest, Votes: votes}
-
-	// inform websockets
-	g.Players.Range(func(_, v interface{}) bool {
-		p := v.(*entities.Player)
-		if p.Ws != nil && p.Uid != origin.Uid {
-			view.WsRenderVote(p.Ws, gid, p.Uid, dest)
-		}
-		return true
-	})
+	gp.publish(events.VoteOpened{Meta: events.In(g), Vote: g.Vote})
 
 	return g.Vote, nil
 }
@@ -78,74 +95,57 @@ func (gp *GamePool) MakeVote(gid string, dest *entities.Player, fromId, vote str
 	}
 
 	if g.Vote == nil {
-		return fmt.Errorf("no votes ongoing in this game")
+		return errorf(Conflict, "no votes ongoing in this game")
 	}
 
 	if g.Vote.DestPlayer.Uid != dest.Uid {
-		return fmt.Errorf("you are trying to vote for %v, while ongoing vote is against %v", dest.Name, g.Vote.DestPlayer.Name)
+		return errorf(Conflict, "you are trying to vote for %v, while ongoing vote is against %v", dest.Name(), g.Vote.DestPlayer.Name())
 	}
 
-	g.Vote.Votes.Store(fromId, vote)
-
-	// notify
-	fmt.Println("voting, waiting?", g.Vote.Waiting)
-	if g.Vote.Waiting {
-		p, err := gp.FindPlayer(gid, fromId)
-		if err != nil {
-			return err
-		}
-
-		if vote == "" {
-			view.WSRenderAddPlayerWait(g.Vote.OriginPlayer.Ws, p)
-			view.WSRenderRemoveTryAgainWait(g.Vote.OriginPlayer.Ws, gid, g.Vote.OriginPlayer.Uid, g.Vote.DestPlayer.Uid)
-		} else {
-			view.WSRenderRemovePlayerWait(g.Vote.OriginPlayer.Ws, p)
-			count := 0
-			g.Vote.Votes.Range(func(k, v interface{}) bool {
-				if vote == "" {
-					count++
-					return false
-				}
-				return true
-			})
-			if count == 0 {
-				view.WSRenderAddTryAgainWait(g.Vote.OriginPlayer.Ws, gid, g.Vote.OriginPlayer.Uid, g.Vote.DestPlayer.Uid)
-			}
-
-		}
+	p, err := gp.FindPlayer(gid, fromId)
+	if err != nil {
+		return err
 	}
+
+	g.Vote.Votes.Store(fromId, vote)
+	gp.publish(events.BallotCast{Meta: events.In(g), Vote: g.Vote, Player: p, Ballot: vote})
 	return nil
 }
 
-func (gp *GamePool) FinishVote(gid string, dest *entities.Player) (*entities.VoteResult, error) {
+func (gp *GamePool) FinishVote(gid string, origin, dest *entities.Player) (*entities.VoteResult, error) {
 	g, err := gp.FindGame(gid)
 	if err != nil {
 		return nil, err
 	}
 
 	if g.Vote == nil {
-		return nil, fmt.Errorf("no votes ongoing in this game")
+		return nil, errorf(Conflict, "no votes ongoing in this game")
+	}
+
+	if g.Vote.OriginPlayer.Uid != origin.Uid {
+		return nil, errorf(Forbidden, "only %v can finish this vote", g.Vote.OriginPlayer.Name())
 	}
 
 	if g.Vote.DestPlayer.Uid != dest.Uid {
-		return nil, fmt.Errorf("you are trying to vote for %v, while ongoing vote is against %v", dest.Name, g.Vote.DestPlayer.Name)
+		return nil, errorf(Conflict, "you are trying to vote for %v, while ongoing vote is against %v", dest.Name(), g.Vote.DestPlayer.Name())
 	}
 
 	var yes []string
 	var no []string
-	var empty []*entities.Player
+	empty := g.MissingVotes()
 
 	g.Vote.Votes.Range(func(k, voteRes interface{}) bool {
-		pui := k.(string)
-		player, _ := g.Players.Load(pui)
+		player, ok := g.Players.Load(k)
+		if !ok {
+			// left during the vote
+			return true
+		}
 		p := player.(*entities.Player)
 		switch voteRes {
 		case "yes":
-			yes = append(yes, p.Name)
+			yes = append(yes, p.Name())
 		case "no":
-			no = append(no, p.Name)
-		case "":
-			empty = append(empty, p)
+			no = append(no, p.Name())
 		}
 		return true
 	})
@@ -153,22 +153,18 @@ func (gp *GamePool) FinishVote(gid string, dest *entities.Player) (*entities.Vot
 	// tie is a fail
 	success := len(yes) > len(no)
 	finished := len(empty) == 0
-	result := &entities.VoteResult{Empty: empty, Yes: yes, No: no, Finished: finished, Success: success, PlayerName: dest.Name}
+	result := &entities.VoteResult{Empty: empty, Yes: yes, No: no, Finished: finished, Success: success, PlayerName: dest.Name()}
 
 	if finished {
 		// finish vote
 		g.Vote = nil
-
-		// inform websockets
-		// todo countdown?
-		// president gets this double, oh well
 		g.Players.Range(func(_, v interface{}) bool {
-			wsPlayer := v.(*entities.Player)
-			if wsPlayer.Ws != nil {
-				view.WsRenderAfterVote(wsPlayer.Ws, result)
-			}
+			v.(*entities.Player).SetPendingResult(result)
 			return true
 		})
+
+		// todo countdown?
+		gp.publish(events.VoteFinished{Meta: events.In(g), Result: result})
 	} else {
 		g.Vote.Waiting = true
 	}
@@ -176,51 +172,119 @@ func (gp *GamePool) FinishVote(gid string, dest *entities.Player) (*entities.Vot
 	return result, nil
 }
 
-func (gp *GamePool) CancelWait(gid string) {
+func (gp *GamePool) CancelWait(gid string, origin *entities.Player) {
 	g, _ := gp.FindGame(gid)
-	if g != nil && g.Vote != nil {
+	if g != nil && g.Vote != nil && g.Vote.OriginPlayer.Uid == origin.Uid {
 		g.Vote.Waiting = false
 	}
 }
 
-func (gp *GamePool) CancelVote(gid string) {
-
+func (gp *GamePool) CancelVote(gid string, origin *entities.Player) error {
 	g, _ := gp.FindGame(gid)
 	if g != nil {
+		if g.Vote != nil && g.Vote.OriginPlayer.Uid != origin.Uid {
+			return errorf(Forbidden, "only %v can cancel this vote", g.Vote.OriginPlayer.Name())
+		}
+
 		g.Vote = nil
-		// inform websockets
-		g.Players.Range(func(_, v interface{}) bool {
-			wsPlayer := v.(*entities.Player)
-			if wsPlayer.Ws != nil {
-				view.WsRenderCancelVote(wsPlayer.Ws)
-			}
-			return true
-		})
+		gp.publish(events.VoteCancelled{Meta: events.In(g)})
 	}
+	return nil
 }
 
 func (gp *GamePool) FindGame(gid string) (*entities.Game, error) {
 	g, _ := gp.Games.Load(gid)
 	if g == nil {
-		errMsg := fmt.Errorf("game with id %v does not exist", gid)
+		errMsg := errorf(NotFound, "game with id %v does not exist", gid)
 		return nil, errMsg
 	}
 
 	return g.(*entities.Game), nil
 }
 
-func (gp *GamePool) SetPlayerWS(conn *websocket.Conn, gid, pid string) error {
+// Subscribe hands all future events of the game to sub, until the returned function is called
+func (gp *GamePool) Subscribe(gid string, sub events.Subscriber) (func(), error) {
+	b, ok := gp.broadcasters.Load(gid)
+	if !ok {
+		return nil, errorf(NotFound, "game with id %v does not exist", gid)
+	}
+
+	return b.(*events.Broadcaster).Subscribe(sub), nil
+}
+
+// Connect subscribes a new connection of the player to the game. The connection first receives a Connected event
+// to catch up with everything that happened while the player was offline. Calling the returned function
+// disconnects it again.
+func (gp *GamePool) Connect(gid string, p *entities.Player, sub events.Subscriber) (func(), error) {
 	g, err := gp.FindGame(gid)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	p, ok := g.Players.Load(pid)
-	if !ok {
-		return fmt.Errorf("player with id %v does not exist in game %v", pid, gid)
+
+	// a removed player gets the news of their removal, but nothing of the game after it, even while their
+	// connection is still closing
+	var left atomic.Bool
+	unsubscribe, err := gp.Subscribe(gid, func(ev events.Event) {
+		if left.Load() {
+			return
+		}
+		if e, ok := ev.(events.PlayerLeft); ok && e.Player.Uid == p.Uid {
+			left.Store(true)
+		}
+		sub(ev)
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	p.(*entities.Player).Ws = conn
-	return nil
+	p.Connections.Add(1)
+	p.Seen(time.Now())
+	sub(events.Connected{Meta: events.In(g), Player: p})
+	gp.updatePresence(g, p)
+
+	return func() {
+		unsubscribe()
+		p.Connections.Add(-1)
+		gp.updatePresence(g, p)
+	}, nil
+}
+
+// PlayerSeen is called on every sign of life from the websocket of a player
+func (gp *GamePool) PlayerSeen(gid string, p *entities.Player) {
+	p.Seen(time.Now())
+
+	g, err := gp.FindGame(gid)
+	if err != nil {
+		return
+	}
+	gp.updatePresence(g, p)
+}
+
+// presenceWatch notices players going silent without their websocket closing, e.g. when a phone goes to sleep
+func (gp *GamePool) presenceWatch() {
+	for {
+		gp.Games.Range(func(_, value interface{}) bool {
+			g := value.(*entities.Game)
+			g.Players.Range(func(_, v interface{}) bool {
+				gp.updatePresence(g, v.(*entities.Player))
+				return true
+			})
+			return true
+		})
+		time.Sleep(time.Second * 5)
+	}
+}
+
+// updatePresence tells everybody in the game when the presence of a player changed
+func (gp *GamePool) updatePresence(g *entities.Game, p *entities.Player) {
+	p.UpdatePresence(func(presence entities.Presence) {
+		gp.publish(events.PresenceChanged{Meta: events.In(g), Player: p, Presence: presence})
+	})
+}
+
+// AckResult marks the last vote result as seen by the player
+func (gp *GamePool) AckResult(p *entities.Player) {
+	p.SetPendingResult(nil)
 }
 
 func (gp *GamePool) FindPlayer(code, playerId string) (*entities.Player, error) {
@@ -231,7 +295,7 @@ func (gp *GamePool) FindPlayer(code, playerId string) (*entities.Player, error)
 
 	p, ok := g.Players.Load(playerId)
 	if !ok {
-		return nil, fmt.Errorf("player with id %v does not exist in game %v", playerId, code)
+		return nil, errorf(NotFound, "player with id %v does not exist in game %v", playerId, code)
 	}
 
 	return p.(*entities.Player), nil
@@ -245,13 +309,17 @@ func (gp *GamePool) VoteForPlayer(code, playerId string) (*entities.Player, erro
 
 	p, ok := g.Players.Load(playerId)
 	if !ok {
-		return nil, fmt.Errorf("player with id %v does not exist in game %v", playerId, code)
+		return nil, errorf(NotFound, "player with id %v does not exist in game %v", playerId, code)
 	}
 
 	return p.(*entities.Player), nil
 }
 
 func (gp *GamePool) StartGame(playerName string) (string, *entities.Player, error) {
+	if gp.closing.Load() {
+		return "", nil, errorf(Unavailable, "the server is restarting, please try again in a moment")
+	}
+
 	iCode := 0
 	const minCode = 11111
 
@@ -264,44 +332,67 @@ func (gp *GamePool) StartGame(playerName string) (string, *entities.Player, erro
 			g := entities.NewGame(code)
 			p, err := g.AddPlayer(playerName)
 			if err != nil {
-				return "", nil, err
+				return "", nil, invalid(err)
 			}
+			g.SetHost(p.Uid)
+			gp.broadcasters.Store(code, events.NewBroadcaster())
 			gp.Games.Store(code, g)
-			fmt.Printf("Starting game %v with DestPlayer %v\n", code, playerName)
+			gp.observers.Publish(events.GameCreated{Meta: events.In(g), Host: p})
+			slog.Info("game started", "game", code, "player", p.Uid, "name", p.Name())
 			return code, p, nil
 		}
-		fmt.Printf("trying to create game, code already existed: %v\n", code)
+		slog.Debug("game code taken, trying another", "game", code)
 	}
 }
 
 func (gp *GamePool) JoinGame(gid string, playerName string) (*entities.Player, error) {
-	fmt.Printf("%v trying to join game %v\n", playerName, gid)
+	// the restart notice went out already, a new player would only be saved half connected
+	if gp.closing.Load() {
+		return nil, errorf(Unavailable, "the server is restarting, please try again in a moment")
+	}
 
 	g, _ := gp.FindGame(gid)
 	if g == nil {
-		fmt.Printf("%v failed to join game %v, code didn't exist\n", playerName, gid)
-		return nil, fmt.Errorf("could not find a game with code %v", gid)
+		slog.Debug("game to join not found", "game", gid)
+		return nil, errorf(NotFound, "could not find a game with code %v", gid)
 	}
 
 	p, err := g.AddPlayer(playerName)
 	if err != nil {
-		return nil, err
+		return nil, invalid(err)
 	}
 
-	// inform websockets
-	g.Players.Range(func(_, v interface{}) bool {
-		wsPlayer := v.(*entities.Player)
-		if wsPlayer.Ws != nil && wsPlayer.Uid != p.Uid {
-			view.WSRenderNewPlayer(wsPlayer.Ws, gid, wsPlayer.Uid, p)
-		}
-		return true
-	})
+	gp.publish(events.PlayerJoined{Meta: events.In(g), Player: p})
 
-	fmt.Printf("%v successfully joined game %v\n", playerName, gid)
+	slog.Info("player joined", "game", gid, "player", p.Uid, "name", p.Name())
 	return p, nil
 }
 
-func (gp *GamePool) RemoveFromGame(code string, playerId string, kill bool) error {
+// RenamePlayer changes the name of a player and shows it to everybody in the game
+func (gp *GamePool) RenamePlayer(code string, p *entities.Player, name string) error {
+	g, err := gp.FindGame(code)
+	if err != nil {
+		return err
+	}
+
+	name, err = entities.CleanName(name)
+	if err != nil {
+		return invalid(err)
+	}
+
+	oldName, err := g.RenamePlayer(p, name)
+	if err != nil {
+		return errorf(Conflict, "there is already a player called %v in this game", name)
+	}
+
+	slog.Info("player renamed", "game", code, "player", p.Uid, "name", name)
+	gp.publish(events.PlayerRenamed{Meta: events.In(g), Player: p, OldName: oldName})
+	return nil
+}
+
+// RemoveFromGame takes a player out of the game. Killing and kicking other players is reserved for the host,
+// leaving is always possible.
+func (gp *GamePool) RemoveFromGame(code string, by *entities.Player, playerId string, reason entities.Removal) error {
 	g, err := gp.FindGame(code)
 	if err != nil {
 		return err
@@ -309,30 +400,142 @@ func (gp *GamePool) RemoveFromGame(code string, playerId string, kill bool) erro
 
 	pl, ok := g.Players.Load(playerId)
 	if !ok {
-		return fmt.Errorf("DestPlayer with id %v does not exist in game %v", playerId, code)
+		return errorf(NotFound, "DestPlayer with id %v does not exist in game %v", playerId, code)
 	}
 	p := pl.(*entities.Player)
 
-	fmt.Printf("remove %v from game %v\n", p.Name, code)
-	if p.Ws != nil && kill {
-		// notify the killed player
-		view.WSRenderRemovedPopup(p.Ws)
+	switch reason {
+	case entities.Left:
+		if by.Uid != p.Uid {
+			return errorf(Forbidden, "you can only leave the game yourself")
+		}
+	case entities.Kicked:
+		if by.Uid == p.Uid {
+			return errorf(Forbidden, "you cannot kick yourself, leave the game instead")
+		}
+		fallthrough
+	case entities.Killed:
+		if !g.IsHost(by) {
+			return errorf(Forbidden, "only the host can do that")
+		}
 	}
 
-	// notify all other players
-	playerLen := 0
-	g.Players.Range(func(_, v interface{}) bool {
-		wsPlayer := v.(*entities.Player)
-		if wsPlayer.Ws != nil && wsPlayer.Uid != p.Uid {
-			view.WSRenderRemovePlayer(wsPlayer.Ws, p.Uid)
+	slog.Info("player removed", "game", code, "player", p.Uid, "reason", reason, "by", by.Uid)
+	gp.removePlayer(g, p, reason)
+	return nil
+}
+
+// removePlayer takes a player out of the game and ends it if nobody is left
+func (gp *GamePool) removePlayer(g *entities.Game, p *entities.Player, reason entities.Removal) {
+	g.Players.Delete(p.Uid)
+	if v := g.Vote; v != nil {
+		if v.OriginPlayer.Uid == p.Uid || v.DestPlayer.Uid == p.Uid {
+			// nobody else may finish or cancel it, the game would be stuck with the vote
+			g.Vote = nil
+			gp.publish(events.VoteCancelled{Meta: events.In(g)})
+		} else {
+			v.Votes.Delete(p.Uid)
 		}
-		playerLen++
-		return true
-	})
+	}
+	gp.publish(events.PlayerLeft{Meta: events.In(g), Player: p, Reason: reason})
+
+	if len(g.PlayerList()) == 0 {
+		gp.deleteGame(g, events.EndedEmpty)
+		return
+	}
+
+	if g.IsHost(p) {
+		// the longest standing player takes over
+		next := g.PlayerList()[0]
+		gp.setHost(g, next)
+	}
+}
 
-	g.Players.Delete(playerId)
-	if playerLen == 1 {
-		gp.Games.Delete(code)
+// FindPlayerAsHost looks up a player for an action that only the host may take
+func (gp *GamePool) FindPlayerAsHost(code string, by *entities.Player, playerId string) (*entities.Player, error) {
+	g, err := gp.FindGame(code)
+	if err != nil {
+		return nil, err
 	}
+
+	if !g.IsHost(by) {
+		return nil, errorf(Forbidden, "only the host can do that")
+	}
+	return gp.FindPlayer(code, playerId)
+}
+
+// TransferHost hands the host role from the current host to another player
+func (gp *GamePool) TransferHost(code string, by *entities.Player, playerId string) error {
+	g, err := gp.FindGame(code)
+	if err != nil {
+		return err
+	}
+
+	if !g.IsHost(by) {
+		return errorf(Forbidden, "only the host can hand over the host role")
+	}
+
+	p, err := gp.FindPlayer(code, playerId)
+	if err != nil {
+		return err
+	}
+
+	gp.setHost(g, p)
 	return nil
 }
+
+// EnactPolicy counts a policy that was laid on the board at the table and returns the new counts, only the host
+// keeps the board
+func (gp *GamePool) EnactPolicy(code string, by *entities.Player, policy entities.Policy) (entities.Policies, error) {
+	g, err := gp.FindGame(code)
+	if err != nil {
+		return entities.Policies{}, err
+	}
+
+	if !g.IsHost(by) {
+		return entities.Policies{}, errorf(Forbidden, "only the host can enact policies")
+	}
+	if policy != entities.Liberal && policy != entities.Fascist {
+		return entities.Policies{}, errorf(Invalid, "unknown policy %q, use liberal or fascist", policy)
+	}
+
+	policies, err := g.Enact(policy)
+	if err != nil {
+		return policies, errorf(Conflict, "%v", err)
+	}
+
+	slog.Info("policy enacted", "game", code, "policy", policy, "liberal", policies.Liberal, "fascist", policies.Fascist)
+	gp.publish(events.PolicyEnacted{Meta: events.In(g), Policy: policy, Policies: policies})
+	return policies, nil
+}
+
+func (gp *GamePool) setHost(g *entities.Game, p *entities.Player) {
+	slog.Info("host changed", "game", g.Code, "player", p.Uid)
+	g.SetHost(p.Uid)
+
+	gp.publish(events.HostChanged{Meta: events.In(g), Host: p})
+}
+
+// Observe hands the events of all games to sub, including GameCreated and GameEnded, until the returned function
+// is called
+func (gp *GamePool) Observe(sub events.Subscriber) func() {
+	return gp.observers.Subscribe(sub)
+}
+
+// publish hands an event to everybody listening to the game it happened in
+func (gp *GamePool) publish(ev events.Event) {
+	gp.observers.Publish(ev)
+
+	b, ok := gp.broadcasters.Load(ev.Source().Game.Code)
+	if !ok {
+		return
+	}
+
+	b.(*events.Broadcaster).Publish(ev)
+}
+
+func (gp *GamePool) deleteGame(g *entities.Game, reason string) {
+	gp.Games.Delete(g.Code)
+	gp.broadcasters.Delete(g.Code)
+	gp.observers.Publish(events.GameEnded{Meta: events.In(g), Reason: reason})
+}
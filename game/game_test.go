@@ -0,0 +1,447 @@
+package game
+
+import (
+	"fmt"
+	"github.com/Neifen/secret-h/entities"
+	"github.com/Neifen/secret-h/events"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// table is a game with a host and two more players, and the events published since it was set up
+type table struct {
+	gp             *GamePool
+	code           string
+	host, eva, mia *entities.Player
+
+	mu     sync.Mutex
+	events []string
+}
+
+func newTable(t *testing.T) *table {
+	t.Helper()
+	gp := NewGamePool(time.Hour)
+	code, host, err := gp.StartGame("Max")
+	if err != nil {
+		t.Fatal(err)
+	}
+	eva, err := gp.JoinGame(code, "Eva")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mia, err := gp.JoinGame(code, "Mia")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tb := &table{gp: gp, code: code, host: host, eva: eva, mia: mia}
+	gp.Observe(func(ev events.Event) {
+		tb.mu.Lock()
+		defer tb.mu.Unlock()
+		tb.events = append(tb.events, fmt.Sprintf("%T", ev))
+	})
+	return tb
+}
+
+func (tb *table) published() []string {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	return slices.Clone(tb.events)
+}
+
+// openVote lets the host open a vote about eva, without recording it
+func (tb *table) openVote(t *testing.T) {
+	t.Helper()
+	if _, err := tb.gp.NewVote(tb.code, tb.host, tb.eva); err != nil {
+		t.Fatal(err)
+	}
+	tb.mu.Lock()
+	tb.events = nil
+	tb.mu.Unlock()
+}
+
+func TestGameEvents(t *testing.T) {
+	tests := []struct {
+		name    string
+		vote    bool // a vote by the host about eva is open before act
+		act     func(tb *table) error
+		wantErr Kind // Internal for no error
+		want    []string
+	}{
+		{
+			name: "join",
+			act: func(tb *table) error {
+				_, err := tb.gp.JoinGame(tb.code, "Tom")
+				return err
+			},
+			want: []string{"events.PlayerJoined"},
+		},
+		{
+			name: "join with a taken name",
+			act: func(tb *table) error {
+				_, err := tb.gp.JoinGame(tb.code, "ＥＶＡ")
+				return err
+			},
+			wantErr: Invalid,
+		},
+		{
+			name: "join unknown game",
+			act: func(tb *table) error {
+				_, err := tb.gp.JoinGame("1", "Tom")
+				return err
+			},
+			wantErr: NotFound,
+		},
+		{
+			name: "join while shutting down",
+			act: func(tb *table) error {
+				tb.gp.closing.Store(true)
+				_, err := tb.gp.JoinGame(tb.code, "Tom")
+				return err
+			},
+			wantErr: Unavailable,
+		},
+		{
+			name: "rename",
+			act: func(tb *table) error {
+				return tb.gp.RenamePlayer(tb.code, tb.eva, "Evi")
+			},
+			want: []string{"events.PlayerRenamed"},
+		},
+		{
+			name: "rename to a taken name",
+			act: func(tb *table) error {
+				return tb.gp.RenamePlayer(tb.code, tb.eva, "mia")
+			},
+			wantErr: Conflict,
+		},
+		{
+			name: "open vote",
+			act: func(tb *table) error {
+				_, err := tb.gp.NewVote(tb.code, tb.host, tb.eva)
+				return err
+			},
+			want: []string{"events.VoteOpened"},
+		},
+		{
+			name: "open a second vote",
+			vote: true,
+			act: func(tb *table) error {
+				_, err := tb.gp.NewVote(tb.code, tb.mia, tb.host)
+				return err
+			},
+			wantErr: Conflict,
+		},
+		{
+			name: "cast ballot",
+			vote: true,
+			act: func(tb *table) error {
+				return tb.gp.MakeVote(tb.code, tb.eva, tb.mia.Uid, "yes")
+			},
+			want: []string{"events.BallotCast"},
+		},
+		{
+			name: "finish with missing ballots",
+			vote: true,
+			act: func(tb *table) error {
+				_ = tb.gp.MakeVote(tb.code, tb.eva, tb.mia.Uid, "yes")
+				_, err := tb.gp.FinishVote(tb.code, tb.host, tb.eva)
+				return err
+			},
+			want: []string{"events.BallotCast"},
+		},
+		{
+			name: "finish",
+			vote: true,
+			act: func(tb *table) error {
+				for _, p := range []*entities.Player{tb.host, tb.eva, tb.mia} {
+					_ = tb.gp.MakeVote(tb.code, tb.eva, p.Uid, "no")
+				}
+				_, err := tb.gp.FinishVote(tb.code, tb.host, tb.eva)
+				return err
+			},
+			want: []string{"events.BallotCast", "events.BallotCast", "events.BallotCast", "events.VoteFinished"},
+		},
+		{
+			name: "finish by someone else",
+			vote: true,
+			act: func(tb *table) error {
+				_, err := tb.gp.FinishVote(tb.code, tb.mia, tb.eva)
+				return err
+			},
+			wantErr: Forbidden,
+		},
+		{
+			name: "cancel vote",
+			vote: true,
+			act: func(tb *table) error {
+				return tb.gp.CancelVote(tb.code, tb.host)
+			},
+			want: []string{"events.VoteCancelled"},
+		},
+		{
+			name: "voter leaves during a vote",
+			vote: true,
+			act: func(tb *table) error {
+				return tb.gp.RemoveFromGame(tb.code, tb.mia, tb.mia.Uid, entities.Left)
+			},
+			want: []string{"events.PlayerLeft"},
+		},
+		{
+			name: "candidate is removed during a vote",
+			vote: true,
+			act: func(tb *table) error {
+				return tb.gp.RemoveByOperator(tb.code, tb.eva.Uid)
+			},
+			want: []string{"events.VoteCancelled", "events.PlayerLeft"},
+		},
+		{
+			name: "president is kicked during a vote",
+			vote: true,
+			act: func(tb *table) error {
+				_ = tb.gp.TransferHost(tb.code, tb.host, tb.mia.Uid)
+				return tb.gp.RemoveFromGame(tb.code, tb.mia, tb.host.Uid, entities.Kicked)
+			},
+			want: []string{"events.HostChanged", "events.VoteCancelled", "events.PlayerLeft"},
+		},
+		{
+			name: "enact policy",
+			act: func(tb *table) error {
+				p, err := tb.gp.EnactPolicy(tb.code, tb.host, entities.Fascist)
+				if err == nil && p != (entities.Policies{Fascist: 1}) {
+					return fmt.Errorf("policies %+v", p)
+				}
+				return err
+			},
+			want: []string{"events.PolicyEnacted"},
+		},
+		{
+			name: "enact policy by someone else than the host",
+			act: func(tb *table) error {
+				_, err := tb.gp.EnactPolicy(tb.code, tb.eva, entities.Liberal)
+				return err
+			},
+			wantErr: Forbidden,
+		},
+		{
+			name: "enact unknown policy",
+			act: func(tb *table) error {
+				_, err := tb.gp.EnactPolicy(tb.code, tb.host, "communist")
+				return err
+			},
+			wantErr: Invalid,
+		},
+		{
+			name: "enact policy on a full board",
+			act: func(tb *table) error {
+				for range entities.MaxLiberal + 1 {
+					if _, err := tb.gp.EnactPolicy(tb.code, tb.host, entities.Liberal); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			wantErr: Conflict,
+			want:    []string{"events.PolicyEnacted", "events.PolicyEnacted", "events.PolicyEnacted", "events.PolicyEnacted", "events.PolicyEnacted"},
+		},
+		{
+			name: "kick by someone else than the host",
+			act: func(tb *table) error {
+				return tb.gp.RemoveFromGame(tb.code, tb.eva, tb.mia.Uid, entities.Kicked)
+			},
+			wantErr: Forbidden,
+		},
+		{
+			name: "host leaves",
+			act: func(tb *table) error {
+				return tb.gp.RemoveFromGame(tb.code, tb.host, tb.host.Uid, entities.Left)
+			},
+			want: []string{"events.PlayerLeft", "events.HostChanged"},
+		},
+		{
+			name: "last player leaves",
+			act: func(tb *table) error {
+				for _, p := range []*entities.Player{tb.eva, tb.mia, tb.host} {
+					if err := tb.gp.RemoveFromGame(tb.code, p, p.Uid, entities.Left); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			want: []string{"events.PlayerLeft", "events.PlayerLeft", "events.PlayerLeft", "events.GameEnded"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tb := newTable(t)
+			if tt.vote {
+				tb.openVote(t)
+			}
+
+			err := tt.act(tb)
+			switch {
+			case tt.wantErr == Internal && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.wantErr != Internal && KindOf(err) != tt.wantErr:
+				t.Fatalf("error = %v of kind %v, want kind %v", err, KindOf(err), tt.wantErr)
+			}
+
+			if got := tb.published(); !slices.Equal(got, tt.want) {
+				t.Errorf("published %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRemovingTheCandidateUnblocksTheGame(t *testing.T) {
+	tb := newTable(t)
+	tb.openVote(t)
+
+	if err := tb.gp.RemoveByOperator(tb.code, tb.eva.Uid); err != nil {
+		t.Fatal(err)
+	}
+
+	// mia can open the next vote, nobody is left waiting for the old one
+	if _, err := tb.gp.NewVote(tb.code, tb.mia, tb.host); err != nil {
+		t.Fatalf("next vote: %v", err)
+	}
+}
+
+// run with -race, players rename themselves while the president counts the ballots
+func TestRenameDuringVote(t *testing.T) {
+	tb := newTable(t)
+	tb.openVote(t)
+	if err := tb.gp.MakeVote(tb.code, tb.eva, tb.eva.Uid, "yes"); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := range 100 {
+			if err := tb.gp.RenamePlayer(tb.code, tb.eva, fmt.Sprintf("Eva %d", i)); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	for range 100 {
+		result, err := tb.gp.FinishVote(tb.code, tb.host, tb.eva)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Yes) != 1 || !strings.HasPrefix(result.Yes[0], "Eva") {
+			t.Fatalf("result %+v", result)
+		}
+	}
+	wg.Wait()
+}
+
+func TestOnlyTheHostFindsPlayersAsHost(t *testing.T) {
+	tb := newTable(t)
+	if _, err := tb.gp.FindPlayerAsHost(tb.code, tb.eva, tb.mia.Uid); KindOf(err) != Forbidden {
+		t.Errorf("eva got %v, want forbidden", err)
+	}
+
+	if err := tb.gp.TransferHost(tb.code, tb.host, tb.eva.Uid); err != nil {
+		t.Fatal(err)
+	}
+	if p, err := tb.gp.FindPlayerAsHost(tb.code, tb.eva, tb.mia.Uid); err != nil || p != tb.mia {
+		t.Errorf("eva as host got %v, %v", p, err)
+	}
+}
+
+// run with -race, reconnecting players read the result while the president finishes the vote
+func TestResultDuringFinish(t *testing.T) {
+	tb := newTable(t)
+	tb.openVote(t)
+	for _, p := range []*entities.Player{tb.host, tb.eva, tb.mia} {
+		if err := tb.gp.MakeVote(tb.code, tb.eva, p.Uid, "yes"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for tb.mia.PendingResult() == nil {
+		}
+	}()
+
+	result, err := tb.gp.FinishVote(tb.code, tb.host, tb.eva)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	if got := tb.mia.PendingResult(); got != result || !result.Success {
+		t.Errorf("pending %+v, finished %+v", got, result)
+	}
+
+	tb.gp.AckResult(tb.mia)
+	if tb.mia.PendingResult() != nil {
+		t.Error("result still pending after it was dismissed")
+	}
+}
+
+func TestTransferIsClaimedOnce(t *testing.T) {
+	tb := newTable(t)
+	token, err := tb.gp.NewTransfer(tb.code, tb.eva)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := tb.eva.SessionId()
+
+	var claimed atomic.Int32
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p, err := tb.gp.ClaimTransfer(tb.code, token)
+			if err == nil {
+				claimed.Add(1)
+				if p != tb.eva {
+					t.Errorf("claimed %v instead of eva", p.Uid)
+				}
+			} else if KindOf(err) != NotFound {
+				t.Errorf("claim: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := claimed.Load(); n != 1 {
+		t.Errorf("claimed %d times", n)
+	}
+	if tb.eva.SessionId() == session {
+		t.Error("the old device keeps its session")
+	}
+}
+
+func TestSnapshotKeepsPolicies(t *testing.T) {
+	tb := newTable(t)
+	for _, policy := range []entities.Policy{entities.Fascist, entities.Liberal, entities.Fascist} {
+		if _, err := tb.gp.EnactPolicy(tb.code, tb.host, policy); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	restored := NewGamePool(time.Hour)
+	if err := restored.Restore(tb.gp.Snapshot()); err != nil {
+		t.Fatal(err)
+	}
+	g, err := restored.FindGame(tb.code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := g.Policies(); got != (entities.Policies{Liberal: 1, Fascist: 2}) {
+		t.Errorf("restored policies %+v", got)
+	}
+}
@@ -3,16 +3,30 @@ package game
 import (
 	"fmt"
 	"github.com/skip2/go-qrcode"
-	"net/http"
 )
 
-func CreateQr(gid string, req *http.Request) ([]byte, error) {
-	host := req.Host
-	pre := "https"
-	if req.TLS == nil {
-		pre = "http"
+// qrLevels maps the names of the config to the error correction of the QR codes
+var qrLevels = map[string]qrcode.RecoveryLevel{
+	"low":     qrcode.Low,
+	"medium":  qrcode.Medium,
+	"high":    qrcode.High,
+	"highest": qrcode.Highest,
+}
+
+// CreateQr links to joining the game, base is the public url of the server
+func CreateQr(base, gid, level string) ([]byte, error) {
+	return encodeQr(fmt.Sprintf("%s/join-qr/%s", base, gid), level)
+}
+
+// CreateTransferQr links to the transfer of a player to another device
+func CreateTransferQr(base, gid, token, level string) ([]byte, error) {
+	return encodeQr(fmt.Sprintf("%s/transfer/%s/%s", base, gid, token), level)
+}
+
+func encodeQr(url, level string) ([]byte, error) {
+	l, ok := qrLevels[level]
+	if !ok {
+		l = qrcode.Medium
 	}
-	url := fmt.Sprintf("%s://%s/join-qr/%s", pre, host, gid)
-	//fmt.Printf("QR URL: %s\n", url)
-	return qrcode.Encode(url, qrcode.Medium, 256)
+	return qrcode.Encode(url, l, 256)
 }
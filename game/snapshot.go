@@ -0,0 +1,129 @@
+package game
+
+import (
+	"fmt"
+	"github.com/Neifen/secret-h/entities"
+	"github.com/Neifen/secret-h/events"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// GameState is what survives a restart of the server. Connections, presence and pending moves to another device
+// do not, the players reconnect anyway.
+type GameState struct {
+	Code      string        `json:"code"`
+	HostUid   string        `json:"hostUid"`
+	CreatedAt time.Time     `json:"createdAt"`
+	Players   []PlayerState `json:"players"`
+	Vote      *VoteState    `json:"vote,omitempty"`
+	Liberal   int           `json:"liberalPolicies,omitempty"`
+	Fascist   int           `json:"fascistPolicies,omitempty"`
+}
+
+type PlayerState struct {
+	Uid           string               `json:"uid"`
+	Name          string               `json:"name"`
+	JoinedAt      time.Time            `json:"joinedAt"`
+	LastSeen      time.Time            `json:"lastSeen"`
+	SessionId     string               `json:"sessionId"`
+	PendingResult *entities.VoteResult `json:"pendingResult,omitempty"`
+}
+
+type VoteState struct {
+	OriginUid string            `json:"originUid"`
+	DestUid   string            `json:"destUid"`
+	Ballots   map[string]string `json:"ballots"` // player uid - "yes", "no" or ""
+	Waiting   bool              `json:"waiting"`
+}
+
+// Close stops new games from being started and tells everybody connected that the server restarts
+func (gp *GamePool) Close() {
+	gp.closing.Store(true)
+
+	gp.Games.Range(func(_, value interface{}) bool {
+		gp.publish(events.ServerRestarting{Meta: events.In(value.(*entities.Game))})
+		return true
+	})
+}
+
+// Snapshot captures the state of all games
+func (gp *GamePool) Snapshot() []GameState {
+	states := []GameState{}
+	gp.Games.Range(func(_, value interface{}) bool {
+		g := value.(*entities.Game)
+		policies := g.Policies()
+		gs := GameState{Code: g.Code, HostUid: g.HostUid(), CreatedAt: g.CreatedAt, Liberal: policies.Liberal, Fascist: policies.Fascist}
+
+		for _, p := range g.PlayerList() {
+			gs.Players = append(gs.Players, PlayerState{
+				Uid:           p.Uid,
+				Name:          p.Name(),
+				JoinedAt:      p.JoinedAt,
+				LastSeen:      p.LastSeen(),
+				SessionId:     p.SessionId(),
+				PendingResult: pendingResult(p.PendingResult()),
+			})
+		}
+
+		if v := g.Vote; v != nil {
+			vs := &VoteState{OriginUid: v.OriginPlayer.Uid, DestUid: v.DestPlayer.Uid, Ballots: map[string]string{}, Waiting: v.Waiting}
+			v.Votes.Range(func(k, b interface{}) bool {
+				vs.Ballots[k.(string)] = b.(string)
+				return true
+			})
+			gs.Vote = vs
+		}
+
+		states = append(states, gs)
+		return true
+	})
+	return states
+}
+
+// Restore brings back the games of a snapshot, before anybody is connected
+func (gp *GamePool) Restore(states []GameState) error {
+	for _, gs := range states {
+		g := entities.NewGame(gs.Code)
+		g.SetHost(gs.HostUid)
+		g.CreatedAt = gs.CreatedAt
+		g.SetPolicies(entities.Policies{Liberal: gs.Liberal, Fascist: gs.Fascist})
+
+		for _, ps := range gs.Players {
+			p := entities.RestorePlayer(ps.Uid, ps.Name, ps.SessionId, ps.JoinedAt)
+			p.SetPendingResult(ps.PendingResult)
+			p.Seen(ps.LastSeen)
+			g.Players.Store(ps.Uid, p)
+		}
+
+		if vs := gs.Vote; vs != nil {
+			origin, ok1 := g.Players.Load(vs.OriginUid)
+			dest, ok2 := g.Players.Load(vs.DestUid)
+			if !ok1 || !ok2 {
+				return fmt.Errorf("vote in game %v is about players that are not part of it", gs.Code)
+			}
+
+			votes := &sync.Map{}
+			for uid, b := range vs.Ballots {
+				votes.Store(uid, b)
+			}
+			g.Vote = &entities.Vote{OriginPlayer: origin.(*entities.Player), DestPlayer: dest.(*entities.Player), Votes: votes, Waiting: vs.Waiting}
+		}
+
+		gp.broadcasters.Store(g.Code, events.NewBroadcaster())
+		gp.Games.Store(g.Code, g)
+	}
+
+	slog.Info("restored games", "count", len(states))
+	return nil
+}
+
+// pendingResult copies a result without the players that did not vote, they only matter while the vote runs
+func pendingResult(r *entities.VoteResult) *entities.VoteResult {
+	if r == nil {
+		return nil
+	}
+	c := *r
+	c.Empty = nil
+	return &c
+}
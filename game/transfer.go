@@ -0,0 +1,61 @@
+package game
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/Neifen/secret-h/entities"
+	"github.com/Neifen/secret-h/events"
+	"log/slog"
+	"time"
+)
+
+const transferLifetime = time.Minute * 2
+
+// NewTransfer creates a single use token that lets the player continue on another device
+func (gp *GamePool) NewTransfer(gid string, p *entities.Player) (string, error) {
+	if _, err := gp.FindGame(gid); err != nil {
+		return "", err
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	token := hex.EncodeToString(b)
+	p.OfferTransfer(&entities.Transfer{Token: token, ExpiresAt: time.Now().Add(transferLifetime)})
+	return token, nil
+}
+
+// ClaimTransfer moves the player with the given token to the device claiming it. The old device loses its
+// session and its websocket is closed.
+func (gp *GamePool) ClaimTransfer(gid, token string) (*entities.Player, error) {
+	g, err := gp.FindGame(gid)
+	if err != nil {
+		return nil, err
+	}
+
+	var p *entities.Player
+	expired := false
+	g.Players.Range(func(_, v interface{}) bool {
+		pl := v.(*entities.Player)
+		claimed, exp := pl.ClaimTransfer(token)
+		if claimed {
+			p, expired = pl, exp
+			return false
+		}
+		return true
+	})
+
+	if p == nil {
+		return nil, errorf(NotFound, "this code is not valid (anymore)")
+	}
+	if expired {
+		return nil, errorf(Forbidden, "this code has expired, please create a new one")
+	}
+
+	slog.Info("player moved to another device", "game", gid, "player", p.Uid)
+	gp.publish(events.PlayerMoved{Meta: events.In(g), Player: p})
+
+	return p, nil
+}
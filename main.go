@@ -1,11 +1,135 @@
 package main
 
-import "github.com/Neifen/secret-h/api"
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/Neifen/secret-h/api"
+	"github.com/Neifen/secret-h/config"
+	"github.com/Neifen/secret-h/tui"
+	"github.com/Neifen/secret-h/webhooks"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+)
 
 //TIP <p>To run your code, right-click the code and select <b>Run</b>.</p> <p>Alternatively, click
 // the <icon src="AllIcons.Actions.Execute"/> icon in the gutter and select the <b>Run</b> menu item from here.</p>
 
 func main() {
-	s := api.NewSession()
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "tui":
+			runTui(os.Args[2:])
+			return
+		case "webhook-receiver":
+			runWebhookReceiver(os.Args[2:])
+			return
+		case "healthcheck":
+			runHealthcheck(os.Args[2:])
+			return
+		}
+	}
+
+	cfg, err := config.Load(os.Args[1:], os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	s := api.NewSession(cfg)
 	s.Start()
 }
+
+// runTui plays a game in the terminal: secret-h tui -name Max [-code 12345] [-server http://localhost:8148]
+func runTui(args []string) {
+	fs := flag.NewFlagSet("tui", flag.ExitOnError)
+	server := fs.String("server", "http://localhost:8148", "address of the Secret-H server")
+	code := fs.String("code", "", "code of the game to join, starts a new game if empty")
+	name := fs.String("name", "", "your name in the game")
+	_ = fs.Parse(args)
+
+	if *name == "" {
+		fmt.Fprintln(os.Stderr, "-name is required")
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	err := tui.Run(ctx, tui.Options{Server: *server, Code: *code, Name: *name}, os.Stdin, os.Stdout)
+	if err != nil && ctx.Err() == nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// runWebhookReceiver prints the webhooks it receives: secret-h webhook-receiver [-addr :9000] [-secret s] [-fail 2]
+func runWebhookReceiver(args []string) {
+	fs := flag.NewFlagSet("webhook-receiver", flag.ExitOnError)
+	addr := fs.String("addr", ":9000", "address to listen on")
+	secret := fs.String("secret", "", "secret to verify the signatures with")
+	fail := fs.Int("fail", 0, "answer the first deliveries with an error, to see the retries")
+	_ = fs.Parse(args)
+
+	fmt.Printf("Receiving webhooks on %v\n", *addr)
+	log.Fatalln(http.ListenAndServe(*addr, webhooks.Receiver(*secret, *fail, os.Stdout)))
+}
+
+// runHealthcheck exits with 0 if the server is alive, for the HEALTHCHECK of the image, which has no curl:
+// secret-h healthcheck [-url http://localhost:8148/healthz]
+// It runs as its own process and does not see the flags of the server, only its environment and config file.
+func runHealthcheck(args []string) {
+	fs := flag.NewFlagSet("healthcheck", flag.ExitOnError)
+	url := fs.String("url", localURL("/healthz"), "health endpoint to probe")
+	_ = fs.Parse(args)
+
+	c := &http.Client{Timeout: time.Second * 3}
+	if strings.HasPrefix(*url, "https://") {
+		// it only asks this machine whether the server runs, the certificate is for the public name
+		c.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	}
+	resp, err := c.Get(*url)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintf(os.Stderr, "%v answered %v\n", *url, resp.Status)
+		os.Exit(1)
+	}
+}
+
+// localURL is a path of the server on this machine, with the address and base path of its config. Flags given to
+// the server are not known here, only the environment and the config file are.
+func localURL(path string) string {
+	cfg, err := config.Load(nil, io.Discard)
+	if err != nil {
+		return "http://localhost:8148" + path
+	}
+
+	host, port, err := net.SplitHostPort(cfg.Addr)
+	if err != nil {
+		return "http://localhost:8148" + path
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	scheme := "http"
+	if cfg.TLSCert != "" {
+		scheme = "https"
+	}
+	return scheme + "://" + net.JoinHostPort(host, port) + cfg.BasePath + path
+}
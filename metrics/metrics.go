@@ -0,0 +1,124 @@
+// Package metrics keeps counters, gauges and histograms and serves them in the Prometheus text format.
+// Metrics are created once, usually as package variables, and register themselves with Default.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// collector is a metric that can write itself in the text format
+type collector interface {
+	name() string
+	write(w io.Writer)
+}
+
+// Registry is a set of metrics that are exposed together
+type Registry struct {
+	mu         sync.Mutex
+	collectors map[string]collector
+}
+
+// Default is the registry every metric of this package registers with
+var Default = &Registry{collectors: map[string]collector{}}
+
+// register adds c, replacing a metric of the same name
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors[c.name()] = c
+}
+
+// Write writes all metrics sorted by name
+func (r *Registry) Write(w io.Writer) {
+	r.mu.Lock()
+	cs := make([]collector, 0, len(r.collectors))
+	for _, c := range r.collectors {
+		cs = append(cs, c)
+	}
+	r.mu.Unlock()
+
+	sort.Slice(cs, func(i, j int) bool { return cs[i].name() < cs[j].name() })
+	for _, c := range cs {
+		c.write(w)
+	}
+}
+
+// Handler serves the metrics of Default
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		Default.Write(w)
+	})
+}
+
+// desc is what every metric has: a name, a help text and the names of its labels
+type desc struct {
+	metricName string
+	help       string
+	typ        string
+	labels     []string
+}
+
+func (d desc) name() string {
+	return d.metricName
+}
+
+func (d desc) header(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %v %v\n# TYPE %v %v\n", d.metricName, d.help, d.metricName, d.typ)
+}
+
+// key joins label values to look up their series, it panics if the number of values is wrong
+func (d desc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metric %v needs %v label values, got %v", d.metricName, len(d.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// labelPairs formats the labels of a series, extra is appended as is, e.g. le="0.5"
+func (d desc) labelPairs(key string, extra string) string {
+	var pairs []string
+	if len(d.labels) > 0 {
+		for i, v := range strings.Split(key, "\xff") {
+			pairs = append(pairs, fmt.Sprintf(`%v="%v"`, d.labels[i], escaper.Replace(v)))
+		}
+	}
+	if extra != "" {
+		pairs = append(pairs, extra)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// sortedKeys lists the series of a metric in a stable order
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// escaper escapes label values the way the text format wants them
+var escaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
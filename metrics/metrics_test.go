@@ -0,0 +1,173 @@
+package metrics
+
+import (
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+	"math"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// parse reads the output the way Prometheus does
+func parse(t *testing.T, text string) map[string]*dto.MetricFamily {
+	t.Helper()
+	p := expfmt.NewTextParser(model.LegacyValidation)
+	families, err := p.TextToMetricFamilies(strings.NewReader(text))
+	if err != nil {
+		t.Fatalf("prometheus cannot read\n%v\n%v", text, err)
+	}
+	return families
+}
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		name string
+		c    func() collector
+		want string
+	}{
+		{
+			name: "counter without labels starts at zero",
+			c: func() collector {
+				return NewCounter("test_started_total", "Started.")
+			},
+			want: `# HELP test_started_total Started.
+# TYPE test_started_total counter
+test_started_total 0
+`,
+		},
+		{
+			name: "counter with labels",
+			c: func() collector {
+				c := NewCounter("test_votes_total", "Votes.", "result")
+				c.Inc("success")
+				c.Add(2.5, "failed")
+				c.Inc("success")
+				return c
+			},
+			want: `# HELP test_votes_total Votes.
+# TYPE test_votes_total counter
+test_votes_total{result="failed"} 2.5
+test_votes_total{result="success"} 2
+`,
+		},
+		{
+			name: "label values are escaped",
+			c: func() collector {
+				c := NewCounter("test_escaped_total", "Escaped.", "path", "code")
+				c.Inc(`a\b"c`+"\n", "200")
+				return c
+			},
+			want: `# HELP test_escaped_total Escaped.
+# TYPE test_escaped_total counter
+test_escaped_total{path="a\\b\"c\n",code="200"} 1
+`,
+		},
+		{
+			name: "gauge goes down",
+			c: func() collector {
+				g := NewGauge("test_connections", "Connections.")
+				g.Inc()
+				g.Inc()
+				g.Dec()
+				g.Add(-3)
+				return g
+			},
+			want: `# HELP test_connections Connections.
+# TYPE test_connections gauge
+test_connections -2
+`,
+		},
+		{
+			name: "gauge set",
+			c: func() collector {
+				g := NewGauge("test_ready", "Ready.", "listener")
+				g.Set(1, "https")
+				g.Set(0, "http")
+				return g
+			},
+			want: `# HELP test_ready Ready.
+# TYPE test_ready gauge
+test_ready{listener="http"} 0
+test_ready{listener="https"} 1
+`,
+		},
+		{
+			name: "gauge func",
+			c: func() collector {
+				return NewGaugeFunc("test_games", "Games.", func() float64 { return 7 })
+			},
+			want: `# HELP test_games Games.
+# TYPE test_games gauge
+test_games 7
+`,
+		},
+		{
+			name: "histogram buckets are cumulative and bounds inclusive",
+			c: func() collector {
+				h := NewHistogram("test_seconds", "Seconds.", []float64{1, 0.5}, "route")
+				for _, v := range []float64{0.1, 0.5, 0.7, 3} {
+					h.Observe(v, "/game")
+				}
+				return h
+			},
+			want: `# HELP test_seconds Seconds.
+# TYPE test_seconds histogram
+test_seconds_bucket{route="/game",le="0.5"} 2
+test_seconds_bucket{route="/game",le="1"} 3
+test_seconds_bucket{route="/game",le="+Inf"} 4
+test_seconds_sum{route="/game"} 4.3
+test_seconds_count{route="/game"} 4
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b strings.Builder
+			tt.c().write(&b)
+			if b.String() != tt.want {
+				t.Errorf("got\n%v\nwant\n%v", b.String(), tt.want)
+			}
+
+			families := parse(t, b.String())
+			if len(families) != 1 {
+				t.Fatalf("prometheus read %v families", len(families))
+			}
+			for _, f := range families {
+				if typ := "# TYPE " + f.GetName() + " " + strings.ToLower(f.GetType().String()); !strings.Contains(tt.want, typ) {
+					t.Errorf("prometheus read %v with %v samples", typ, len(f.GetMetric()))
+				}
+			}
+		})
+	}
+}
+
+func TestHandlerSortsByName(t *testing.T) {
+	NewCounter("test_b_total", "B.")
+	NewGaugeFunc("test_a", "A.", func() float64 { return math.Inf(1) })
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("content type %q", ct)
+	}
+	body := rec.Body.String()
+	parse(t, body)
+	a, b := strings.Index(body, "test_a +Inf\n"), strings.Index(body, "test_b_total 0\n")
+	if a < 0 || b < 0 || a > b {
+		t.Errorf("test_a should come before test_b_total in\n%v", body)
+	}
+}
+
+func TestWrongNumberOfLabelsPanics(t *testing.T) {
+	c := NewCounter("test_labelled_total", "Labelled.", "a", "b")
+	defer func() {
+		if recover() == nil {
+			t.Error("no panic")
+		}
+	}()
+	c.Inc("only one")
+}
@@ -0,0 +1,166 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+)
+
+// Counter only goes up, like the number of votes opened
+type Counter struct {
+	desc
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{desc: desc{metricName: name, help: help, typ: "counter", labels: labels}, values: map[string]float64{}}
+	if len(labels) == 0 {
+		c.values[""] = 0
+	}
+	Default.register(c)
+	return c
+}
+
+// Inc adds one to the series of the label values
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+func (c *Counter) Add(v float64, values ...string) {
+	if v < 0 {
+		panic(fmt.Sprintf("counter %v cannot go down", c.metricName))
+	}
+	k := c.key(values)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[k] += v
+}
+
+func (c *Counter) write(w io.Writer) {
+	c.header(w)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, k := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%v%v %v\n", c.metricName, c.labelPairs(k, ""), formatFloat(c.values[k]))
+	}
+}
+
+// Gauge goes up and down, like the number of open connections
+type Gauge struct {
+	Counter
+}
+
+func NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{Counter{desc: desc{metricName: name, help: help, typ: "gauge", labels: labels}, values: map[string]float64{}}}
+	if len(labels) == 0 {
+		g.values[""] = 0
+	}
+	Default.register(g)
+	return g
+}
+
+// Add changes the series of the label values by v, which may be negative
+func (g *Gauge) Add(v float64, values ...string) {
+	k := g.key(values)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.values[k] += v
+}
+
+func (g *Gauge) Inc(values ...string) {
+	g.Add(1, values...)
+}
+
+func (g *Gauge) Dec(values ...string) {
+	g.Add(-1, values...)
+}
+
+func (g *Gauge) Set(v float64, values ...string) {
+	k := g.key(values)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.values[k] = v
+}
+
+// GaugeFunc asks for its value whenever the metrics are scraped, for values that are already tracked elsewhere
+type GaugeFunc struct {
+	desc
+	f func() float64
+}
+
+func NewGaugeFunc(name, help string, f func() float64) *GaugeFunc {
+	g := &GaugeFunc{desc: desc{metricName: name, help: help, typ: "gauge"}, f: f}
+	Default.register(g)
+	return g
+}
+
+func (g *GaugeFunc) write(w io.Writer) {
+	g.header(w)
+	fmt.Fprintf(w, "%v %v\n", g.metricName, formatFloat(g.f()))
+}
+
+// DefBuckets suit durations of requests in seconds
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Histogram counts observations, like durations, in buckets
+type Histogram struct {
+	desc
+	buckets []float64 // upper bounds, ascending
+	mu      sync.Mutex
+	series  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	counts []uint64 // per bucket, not cumulative, the last one is +Inf
+	sum    float64
+	count  uint64
+}
+
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	b := append([]float64{}, buckets...)
+	sort.Float64s(b)
+	h := &Histogram{desc: desc{metricName: name, help: help, typ: "histogram", labels: labels}, buckets: b, series: map[string]*histogramSeries{}}
+	Default.register(h)
+	return h
+}
+
+// Observe records v in the series of the label values
+func (h *Histogram) Observe(v float64, values ...string) {
+	k := h.key(values)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.series[k]
+	if !ok {
+		s = &histogramSeries{counts: make([]uint64, len(h.buckets)+1)}
+		h.series[k] = s
+	}
+	i := sort.SearchFloat64s(h.buckets, v)
+	s.counts[i]++
+	s.sum += v
+	s.count++
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.header(w)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, k := range sortedKeys(h.series) {
+		s := h.series[k]
+		var cumulative uint64
+		for i, c := range s.counts {
+			cumulative += c
+			le := math.Inf(1)
+			if i < len(h.buckets) {
+				le = h.buckets[i]
+			}
+			fmt.Fprintf(w, "%v_bucket%v %v\n", h.metricName, h.labelPairs(k, fmt.Sprintf(`le="%v"`, formatFloat(le))), cumulative)
+		}
+		fmt.Fprintf(w, "%v_sum%v %v\n", h.metricName, h.labelPairs(k, ""), formatFloat(s.sum))
+		fmt.Fprintf(w, "%v_count%v %v\n", h.metricName, h.labelPairs(k, ""), s.count)
+	}
+}
@@ -0,0 +1,341 @@
+// Package mqtt publishes the events of games to an MQTT broker, e.g. to drive lights and buzzers on the table.
+// It speaks just enough MQTT 3.1.1 to publish with QoS 0: connect, publish, ping and disconnect.
+package mqtt
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	queueSize = 64
+	// keepAlive is announced to the broker, a ping is sent every half of it
+	keepAlive    = time.Second * 60
+	dialTimeout  = time.Second * 10
+	writeTimeout = time.Second * 5
+	// reconnecting waits minReconnect at first and twice as long after every failure, up to maxReconnect
+	minReconnect = time.Second
+	maxReconnect = time.Second * 30
+)
+
+// packet types, already shifted into the upper half of the first byte
+const (
+	packetConnect    = 0x10
+	packetConnack    = 0x20
+	packetPublish    = 0x30
+	packetPingreq    = 0xc0
+	packetDisconnect = 0xe0
+)
+
+// Options of the publisher
+type Options struct {
+	Broker   string // tcp://host:port or mqtts://host:port, the port defaults to 1883 or 8883
+	Prefix   string // topics are <prefix>/<game code>/...
+	ClientId string
+	Username string
+	Password string
+}
+
+type message struct {
+	topic   string
+	payload []byte
+}
+
+// Publisher keeps a connection to the broker and reconnects when it is lost. Publishing never blocks,
+// messages wait in a small queue while the broker is away and are dropped if it runs full.
+type Publisher struct {
+	opts      Options
+	queue     chan message
+	done      chan struct{}
+	stopped   chan struct{}
+	closeOnce sync.Once // Close may be called again, e.g. by a second signal
+}
+
+func NewPublisher(opts Options) (*Publisher, error) {
+	if _, err := brokerAddress(opts.Broker); err != nil {
+		return nil, err
+	}
+
+	p := &Publisher{
+		opts:    opts,
+		queue:   make(chan message, queueSize),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go p.run()
+	return p, nil
+}
+
+// Publish queues a message for <prefix>/<topic>
+func (p *Publisher) Publish(topic string, payload []byte) {
+	select {
+	case <-p.done:
+	case p.queue <- message{topic: p.opts.Prefix + "/" + topic, payload: payload}:
+	default:
+		slog.Warn("MQTT queue full, dropping message", "topic", topic)
+	}
+}
+
+// Close sends what is still queued if the broker is connected and disconnects, or gives up when ctx is done
+func (p *Publisher) Close(ctx context.Context) error {
+	p.closeOnce.Do(func() { close(p.done) })
+	select {
+	case <-p.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *Publisher) run() {
+	defer close(p.stopped)
+
+	wait := minReconnect
+	for {
+		conn, err := p.connect()
+		if err == nil {
+			slog.Info("connected to MQTT broker", "broker", p.opts.Broker)
+			wait = minReconnect
+			err = p.serve(conn)
+			if err == nil {
+				return
+			}
+			slog.Warn("lost MQTT broker, reconnecting", "broker", p.opts.Broker, "retry_in", wait, "err", err)
+		} else {
+			slog.Warn("could not connect to MQTT broker", "broker", p.opts.Broker, "retry_in", wait, "err", err)
+		}
+
+		select {
+		case <-p.done:
+			return
+		case <-time.After(wait):
+		}
+		wait = min(wait*2, maxReconnect)
+	}
+}
+
+// connect dials the broker and waits until it accepts the connection
+func (p *Publisher) connect() (net.Conn, error) {
+	addr, _ := brokerAddress(p.opts.Broker)
+	dialer := &net.Dialer{Timeout: dialTimeout}
+
+	var conn net.Conn
+	var err error
+	if addr.Scheme == "mqtts" || addr.Scheme == "ssl" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr.Host, &tls.Config{ServerName: addr.Hostname()})
+	} else {
+		conn, err = dialer.Dial("tcp", addr.Host)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = write(conn, connectPacket(p.opts))
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(dialTimeout))
+	typ, body, err := readPacket(conn)
+	if err == nil && (typ != packetConnack || len(body) != 2) {
+		err = fmt.Errorf("expected CONNACK, got packet %#x", typ)
+	}
+	if err == nil && body[1] != 0 {
+		err = fmt.Errorf("broker refused the connection with code %v", body[1])
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// serve publishes the queue until the connection breaks or the publisher is closed, which returns nil
+func (p *Publisher) serve(conn net.Conn) error {
+	defer conn.Close()
+
+	// the broker only answers pings, reading notices when it is gone
+	broken := make(chan error, 1)
+	go func() {
+		for {
+			_ = conn.SetReadDeadline(time.Now().Add(keepAlive))
+			if _, _, err := readPacket(conn); err != nil {
+				broken <- err
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(keepAlive / 2)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			p.flush(conn)
+			_ = write(conn, []byte{packetDisconnect, 0})
+			return nil
+		case m := <-p.queue:
+			if err := write(conn, publishPacket(m)); err != nil {
+				p.requeue(m)
+				return err
+			}
+		case <-ping.C:
+			if err := write(conn, []byte{packetPingreq, 0}); err != nil {
+				return err
+			}
+		case err := <-broken:
+			return err
+		}
+	}
+}
+
+// flush sends what is left in the queue before disconnecting
+func (p *Publisher) flush(conn net.Conn) {
+	for {
+		select {
+		case m := <-p.queue:
+			if write(conn, publishPacket(m)) != nil {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+// requeue keeps a message that could not be sent for the next connection
+func (p *Publisher) requeue(m message) {
+	select {
+	case p.queue <- m:
+	default:
+	}
+}
+
+func brokerAddress(broker string) (*url.URL, error) {
+	if broker == "" {
+		return nil, errors.New("no MQTT broker given")
+	}
+	if !containsScheme(broker) {
+		broker = "tcp://" + broker
+	}
+
+	u, err := url.Parse(broker)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MQTT broker %q: %w", broker, err)
+	}
+	switch u.Scheme {
+	case "tcp", "mqtt":
+		if u.Port() == "" {
+			u.Host = net.JoinHostPort(u.Hostname(), "1883")
+		}
+	case "mqtts", "ssl":
+		if u.Port() == "" {
+			u.Host = net.JoinHostPort(u.Hostname(), "8883")
+		}
+	default:
+		return nil, fmt.Errorf("invalid MQTT broker %q: use tcp:// or mqtts://", broker)
+	}
+	return u, nil
+}
+
+func containsScheme(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && u.Scheme != "" && u.Host != ""
+}
+
+func connectPacket(opts Options) []byte {
+	var flags byte = 0x02 // clean session
+	if opts.Username != "" {
+		flags |= 0x80
+	}
+	if opts.Password != "" {
+		flags |= 0x40
+	}
+
+	body := appendString(nil, "MQTT")
+	body = append(body, 4, flags) // protocol level 4 is MQTT 3.1.1
+	body = binary.BigEndian.AppendUint16(body, uint16(keepAlive/time.Second))
+	body = appendString(body, opts.ClientId)
+	if opts.Username != "" {
+		body = appendString(body, opts.Username)
+	}
+	if opts.Password != "" {
+		body = appendString(body, opts.Password)
+	}
+	return packet(packetConnect, body)
+}
+
+// publishPacket is a PUBLISH with QoS 0, which needs neither a packet id nor an acknowledgement
+func publishPacket(m message) []byte {
+	body := appendString(nil, m.topic)
+	body = append(body, m.payload...)
+	return packet(packetPublish, body)
+}
+
+func packet(typ byte, body []byte) []byte {
+	b := []byte{typ}
+	// the remaining length takes 7 bits per byte, the 8th tells that another byte follows
+	n := len(body)
+	for {
+		digit := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			digit |= 0x80
+		}
+		b = append(b, digit)
+		if n == 0 {
+			break
+		}
+	}
+	return append(b, body...)
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+func write(conn net.Conn, b []byte) error {
+	_ = conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	_, err := conn.Write(b)
+	return err
+}
+
+// readPacket returns the type of the next packet and its body
+func readPacket(r io.Reader) (byte, []byte, error) {
+	var b [1]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return 0, nil, err
+	}
+	typ := b[0] & 0xf0
+
+	n, shift := 0, 0
+	for {
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return 0, nil, err
+		}
+		n |= int(b[0]&0x7f) << shift
+		if b[0]&0x80 == 0 {
+			break
+		}
+		shift += 7
+		if shift > 21 {
+			return 0, nil, errors.New("malformed remaining length")
+		}
+	}
+
+	body := make([]byte, n)
+	_, err := io.ReadFull(r, body)
+	return typ, body, err
+}
@@ -0,0 +1,185 @@
+package mqtt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestRemainingLength(t *testing.T) {
+	// the boundaries of the one to four byte encodings from the MQTT 3.1.1 spec
+	tests := []struct {
+		length int
+		want   []byte
+	}{
+		{0, []byte{0x00}},
+		{127, []byte{0x7f}},
+		{128, []byte{0x80, 0x01}},
+		{321, []byte{0xc1, 0x02}},
+		{16383, []byte{0xff, 0x7f}},
+		{16384, []byte{0x80, 0x80, 0x01}},
+		{2097151, []byte{0xff, 0xff, 0x7f}},
+		{2097152, []byte{0x80, 0x80, 0x80, 0x01}},
+	}
+
+	for _, tt := range tests {
+		body := bytes.Repeat([]byte{'x'}, tt.length)
+		p := packet(packetPublish, body)
+
+		if p[0] != packetPublish || !bytes.Equal(p[1:1+len(tt.want)], tt.want) || len(p) != 1+len(tt.want)+tt.length {
+			t.Errorf("length %v encoded as % x, want % x", tt.length, p[1:min(len(p), 5)], tt.want)
+			continue
+		}
+
+		typ, got, err := readPacket(bytes.NewReader(p))
+		if err != nil || typ != packetPublish || !bytes.Equal(got, body) {
+			t.Errorf("length %v read back as type %#x with %v bytes, err %v", tt.length, typ, len(got), err)
+		}
+	}
+}
+
+func TestReadPacket(t *testing.T) {
+	tests := []struct {
+		name     string
+		in       []byte
+		wantType byte
+		wantBody []byte
+		wantErr  error // matched with errors.Is if set
+		wantFail bool
+	}{
+		{name: "connack", in: []byte{0x20, 0x02, 0x00, 0x00}, wantType: packetConnack, wantBody: []byte{0, 0}},
+		{name: "flags are dropped from the type", in: []byte{0x32, 0x01, 0xaa}, wantType: packetPublish, wantBody: []byte{0xaa}},
+		{name: "reads only one packet", in: []byte{0xd0, 0x00, 0xd0, 0x00}, wantType: 0xd0, wantBody: []byte{}},
+		{name: "empty", in: nil, wantErr: io.EOF, wantFail: true},
+		{name: "no length", in: []byte{0x20}, wantErr: io.EOF, wantFail: true},
+		{name: "length cut off", in: []byte{0x30, 0x80}, wantErr: io.EOF, wantFail: true},
+		{name: "body cut off", in: []byte{0x20, 0x02, 0x00}, wantErr: io.ErrUnexpectedEOF, wantFail: true},
+		{name: "length over four bytes", in: []byte{0x30, 0x80, 0x80, 0x80, 0x80, 0x01}, wantFail: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			typ, body, err := readPacket(bytes.NewReader(tt.in))
+			if tt.wantFail {
+				if err == nil || (tt.wantErr != nil && !errors.Is(err, tt.wantErr)) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if typ != tt.wantType || !bytes.Equal(body, tt.wantBody) {
+				t.Errorf("got type %#x body % x, want %#x % x", typ, body, tt.wantType, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestConnectPacket(t *testing.T) {
+	p := connectPacket(Options{ClientId: "h", Username: "u", Password: "p"})
+	want := []byte{
+		packetConnect, 19,
+		0, 4, 'M', 'Q', 'T', 'T', 4, 0xc2, 0, 60,
+		0, 1, 'h',
+		0, 1, 'u',
+		0, 1, 'p',
+	}
+	if !bytes.Equal(p, want) {
+		t.Errorf("got % x\nwant % x", p, want)
+	}
+}
+
+func TestCloseTwice(t *testing.T) {
+	// nothing listens there, the publisher keeps trying to reconnect
+	p, err := NewPublisher(Options{Broker: "tcp://127.0.0.1:1", Prefix: "secret-h", ClientId: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := p.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	p.Publish("42/vote/opened", nil)
+}
+
+// accept waits for the publisher to connect to the fake broker, checks its CONNECT and accepts it
+func accept(t *testing.T, ln *net.TCPListener) net.Conn {
+	t.Helper()
+	_ = ln.SetDeadline(time.Now().Add(5 * time.Second))
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	typ, body, err := readPacket(conn)
+	if err != nil || typ != packetConnect {
+		t.Fatalf("got packet %#x, err %v, want CONNECT", typ, err)
+	}
+	head := []byte{0, 4, 'M', 'Q', 'T', 'T', 4, 0xc2}
+	tail := []byte{0, 4, 't', 'e', 's', 't', 0, 1, 'u', 0, 2, 'p', 'w'}
+	if !bytes.HasPrefix(body, head) || !bytes.HasSuffix(body, tail) {
+		t.Fatalf("CONNECT % x", body)
+	}
+
+	if _, err := conn.Write([]byte{packetConnack, 2, 0, 0}); err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func expectPublish(t *testing.T, conn net.Conn, topic, payload string) {
+	t.Helper()
+	typ, body, err := readPacket(conn)
+	if err != nil || typ != packetPublish {
+		t.Fatalf("got packet %#x, err %v, want PUBLISH", typ, err)
+	}
+	want := append(appendString(nil, topic), payload...)
+	if !bytes.Equal(body, want) {
+		t.Errorf("PUBLISH %q, want %q", body, want)
+	}
+}
+
+func TestPublishToBroker(t *testing.T) {
+	ln, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	p, err := NewPublisher(Options{Broker: "tcp://" + ln.Addr().String(), Prefix: "secret-h", ClientId: "test", Username: "u", Password: "pw"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	defer p.Close(ctx)
+
+	conn := accept(t, ln)
+	p.Publish("42/"+TopicVoteOpened, []byte(`{"candidate":"Eva"}`))
+	expectPublish(t, conn, "secret-h/42/vote/opened", `{"candidate":"Eva"}`)
+
+	// the broker drops the connection, the publisher connects again and goes on
+	_ = conn.Close()
+	conn = accept(t, ln)
+	p.Publish("42/"+TopicPolicyEnacted, []byte(`{"policy":"fascist"}`))
+	expectPublish(t, conn, "secret-h/42/policy/enacted", `{"policy":"fascist"}`)
+
+	if err := p.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if typ, _, err := readPacket(conn); err != nil || typ != packetDisconnect {
+		t.Errorf("got packet %#x, err %v, want DISCONNECT", typ, err)
+	}
+}
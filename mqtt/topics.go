@@ -0,0 +1,67 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"github.com/Neifen/secret-h/entities"
+	"github.com/Neifen/secret-h/events"
+	"github.com/Neifen/secret-h/protocol"
+	"log/slog"
+)
+
+// Topics below <prefix>/<game code>/
+const (
+	TopicVoteOpened     = "vote/opened"
+	TopicVoteResult     = "vote/result"
+	TopicPolicyEnacted  = "policy/enacted"
+	TopicPlayerExecuted = "player/executed"
+)
+
+type VoteOpened struct {
+	President protocol.Player `json:"president"`
+	Candidate protocol.Player `json:"candidate"`
+}
+
+// PolicyEnacted tells which policy was laid on the board, e.g. to light the row of its party
+type PolicyEnacted struct {
+	Policy   string            `json:"policy"` // "liberal" or "fascist"
+	Policies protocol.Policies `json:"policies"`
+}
+
+type PlayerExecuted struct {
+	Player protocol.Player `json:"player"`
+}
+
+// Observer publishes the events of all games that matter at the table, for GamePool.Observe
+func (p *Publisher) Observer() events.Subscriber {
+	return func(ev events.Event) {
+		g := ev.Source().Game
+
+		var topic string
+		var data any
+		switch e := ev.(type) {
+		case events.VoteOpened:
+			topic, data = TopicVoteOpened, VoteOpened{
+				President: protocol.NewPlayer(g, e.Vote.OriginPlayer),
+				Candidate: protocol.NewPlayer(g, e.Vote.DestPlayer),
+			}
+		case events.VoteFinished:
+			topic, data = TopicVoteResult, protocol.NewResult(e.Result)
+		case events.PolicyEnacted:
+			topic, data = TopicPolicyEnacted, PolicyEnacted{Policy: string(e.Policy), Policies: protocol.NewPolicies(e.Policies)}
+		case events.PlayerLeft:
+			if e.Reason != entities.Killed {
+				return
+			}
+			topic, data = TopicPlayerExecuted, PlayerExecuted{Player: protocol.NewPlayer(g, e.Player)}
+		default:
+			return
+		}
+
+		payload, err := json.Marshal(data)
+		if err != nil {
+			slog.Error("could not encode MQTT payload", "game", g.Code, "topic", topic, "err", err)
+			return
+		}
+		p.Publish(g.Code+"/"+topic, payload)
+	}
+}
@@ -0,0 +1,86 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Neifen/secret-h/entities"
+)
+
+// Command types, sent by the client
+const (
+	CommandBallot     = "ballot"
+	CommandFinishVote = "finish_vote"
+	CommandCancelVote = "cancel_vote"
+	CommandCancelWait = "cancel_wait"
+	CommandAckResult  = "ack_result"
+)
+
+// Replies that are only sent to the player whose command caused them
+const (
+	TypeError       = "error"
+	TypeVoteWaiting = "vote_waiting"
+)
+
+// Command is an action of a player sent over the websocket. Unknown fields are ignored, so htmx can send
+// its headers along.
+type Command struct {
+	Type string `json:"type"`
+	// Candidate is the id of the player the vote is about, so a command for a vote that is already over fails
+	Candidate string `json:"candidate,omitempty"`
+	// Ballot is "yes", "no" or "" to take the vote back
+	Ballot string `json:"ballot,omitempty"`
+}
+
+// Error is the data of an error message, and the body of every failed request to the REST api
+type Error struct {
+	// Code is one of the Code* constants, only set by the REST api
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
+}
+
+// VoteWaiting answers finish_vote while players have not voted yet
+type VoteWaiting struct {
+	Missing []Player `json:"missing"`
+}
+
+func ParseCommand(msg []byte) (Command, error) {
+	var cmd Command
+	if err := json.Unmarshal(msg, &cmd); err != nil {
+		return cmd, fmt.Errorf("invalid command: %w", err)
+	}
+
+	switch cmd.Type {
+	case CommandBallot:
+		if !ValidBallot(cmd.Ballot) {
+			return cmd, fmt.Errorf("invalid ballot %q", cmd.Ballot)
+		}
+		fallthrough
+	case CommandFinishVote, CommandCancelWait:
+		if cmd.Candidate == "" {
+			return cmd, fmt.Errorf("command %v needs a candidate", cmd.Type)
+		}
+	case CommandCancelVote, CommandAckResult:
+	default:
+		return cmd, fmt.Errorf("unknown command %q", cmd.Type)
+	}
+	return cmd, nil
+}
+
+// ValidBallot reports whether b is "yes", "no" or "" to take a vote back
+func ValidBallot(b string) bool {
+	return b == "" || b == "yes" || b == "no"
+}
+
+// NewError is the reply to a command that failed
+func NewError(err error) Message {
+	return message(TypeError, Error{Message: err.Error()})
+}
+
+// NewVoteWaiting is the reply to finish_vote while players are missing
+func NewVoteWaiting(g *entities.Game, missing []*entities.Player) Message {
+	w := VoteWaiting{Missing: []Player{}}
+	for _, p := range missing {
+		w.Missing = append(w.Missing, NewPlayer(g, p))
+	}
+	return message(TypeVoteWaiting, w)
+}
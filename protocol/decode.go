@@ -0,0 +1,79 @@
+package protocol
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrUnknownType is returned for messages of a newer server, clients can skip them
+var ErrUnknownType = errors.New("unknown message type")
+
+// Messages without data, so every message type has a Go type to switch on
+type (
+	Moved         struct{}
+	VoteCancelled struct{}
+	Restarting    struct{}
+)
+
+// RawMessage is a Message as received, before its data is decoded
+type RawMessage struct {
+	Version int             `json:"v"`
+	Type    string          `json:"type"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+// Decode reads a message sent over a JSON websocket into the Go type of its data, e.g. Hello or BallotUpdated
+func Decode(b []byte) (any, error) {
+	var raw RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("invalid message: %w", err)
+	}
+	if raw.Version != Version {
+		return nil, fmt.Errorf("unsupported protocol version %v, expected %v", raw.Version, Version)
+	}
+
+	switch raw.Type {
+	case TypeHello:
+		return decodeData[Hello](raw)
+	case TypePlayerJoined:
+		return decodeData[PlayerJoined](raw)
+	case TypePlayerLeft:
+		return decodeData[PlayerLeft](raw)
+	case TypePlayerRenamed:
+		return decodeData[PlayerRenamed](raw)
+	case TypeHostChanged:
+		return decodeData[HostChanged](raw)
+	case TypePresenceChanged:
+		return decodeData[PresenceChanged](raw)
+	case TypeMoved:
+		return Moved{}, nil
+	case TypeVoteOpened:
+		return decodeData[VoteOpened](raw)
+	case TypeBallotUpdated:
+		return decodeData[BallotUpdated](raw)
+	case TypeVoteFinished:
+		return decodeData[VoteFinished](raw)
+	case TypeVoteCancelled:
+		return VoteCancelled{}, nil
+	case TypeRestarting:
+		return Restarting{}, nil
+	case TypeAnnouncement:
+		return decodeData[Announcement](raw)
+	case TypePolicyEnacted:
+		return decodeData[PolicyEnacted](raw)
+	case TypeVoteWaiting:
+		return decodeData[VoteWaiting](raw)
+	case TypeError:
+		return decodeData[Error](raw)
+	}
+	return nil, fmt.Errorf("%w %q", ErrUnknownType, raw.Type)
+}
+
+func decodeData[T any](raw RawMessage) (any, error) {
+	var data T
+	if err := json.Unmarshal(raw.Data, &data); err != nil {
+		return nil, fmt.Errorf("invalid %v message: %w", raw.Type, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,181 @@
+package protocol
+
+import (
+	"github.com/Neifen/secret-h/entities"
+)
+
+// Version of the JSON protocol, sent with every message. It changes whenever a message changes incompatibly.
+const Version = 1
+
+// Message types
+const (
+	TypeHello           = "hello"
+	TypePlayerJoined    = "player_joined"
+	TypePlayerLeft      = "player_left"
+	TypePlayerRenamed   = "player_renamed"
+	TypeHostChanged     = "host_changed"
+	TypePresenceChanged = "presence_changed"
+	TypeMoved           = "moved"
+	TypeVoteOpened      = "vote_opened"
+	TypeBallotUpdated   = "ballot_updated"
+	TypeVoteFinished    = "vote_finished"
+	TypeVoteCancelled   = "vote_cancelled"
+	TypeRestarting      = "restarting"
+	TypeAnnouncement    = "announcement"
+	TypePolicyEnacted   = "policy_enacted"
+)
+
+// Message is the envelope of everything sent over a JSON websocket
+type Message struct {
+	Version int    `json:"v"`
+	Type    string `json:"type"`
+	Data    any    `json:"data,omitempty"`
+}
+
+type Player struct {
+	Id       string `json:"id"`
+	Name     string `json:"name"`
+	Host     bool   `json:"host"`
+	Presence string `json:"presence"`
+}
+
+type Vote struct {
+	President Player `json:"president"`
+	Candidate Player `json:"candidate"`
+	// Ballot is the own choice of the receiving player: "yes", "no" or "" if not voted yet
+	Ballot string `json:"ballot"`
+	// Missing are the ids of the players that have not voted yet
+	Missing []string `json:"missing"`
+}
+
+type Result struct {
+	Candidate string   `json:"candidate"`
+	Success   bool     `json:"success"`
+	Yes       []string `json:"yes"` // names
+	No        []string `json:"no"`  // names
+}
+
+// Policies counts the policies on the board at the table
+type Policies struct {
+	Liberal int `json:"liberal"`
+	Fascist int `json:"fascist"`
+}
+
+// Hello is the first message on every connection and contains the whole state of the game
+type Hello struct {
+	Game          string   `json:"game"`
+	You           Player   `json:"you"`
+	Players       []Player `json:"players"`
+	Vote          *Vote    `json:"vote,omitempty"`
+	PendingResult *Result  `json:"pendingResult,omitempty"`
+	Policies      Policies `json:"policies"`
+}
+
+type PlayerJoined struct {
+	Player Player `json:"player"`
+}
+
+type PlayerLeft struct {
+	Player Player `json:"player"`
+	// Reason is "left", "killed", "kicked" or "removed" by the operator of the server
+	Reason string `json:"reason"`
+}
+
+type PlayerRenamed struct {
+	Player  Player `json:"player"`
+	OldName string `json:"oldName"`
+}
+
+type HostChanged struct {
+	Host Player `json:"host"`
+}
+
+type PresenceChanged struct {
+	Player Player `json:"player"`
+}
+
+type VoteOpened struct {
+	Vote Vote `json:"vote"`
+}
+
+// BallotUpdated tells that a player voted or took their vote back. The choice itself stays secret until the end.
+type BallotUpdated struct {
+	Player Player `json:"player"`
+	Voted  bool   `json:"voted"`
+	Vote   Vote   `json:"vote"`
+}
+
+type VoteFinished struct {
+	Result Result `json:"result"`
+}
+
+// PolicyEnacted is a policy laid on the board, Policies include it
+type PolicyEnacted struct {
+	Policy   string   `json:"policy"` // "liberal" or "fascist"
+	Policies Policies `json:"policies"`
+}
+
+// Announcement is a message from the operator of the server
+type Announcement struct {
+	Text string `json:"text"`
+}
+
+func NewPlayer(g *entities.Game, p *entities.Player) Player {
+	return Player{Id: p.Uid, Name: p.Name(), Host: g.IsHost(p), Presence: string(p.CurrentPresence())}
+}
+
+// NewVote describes the ongoing vote as seen by player p
+func NewVote(g *entities.Game, v *entities.Vote, p *entities.Player) Vote {
+	ballot, _ := v.Votes.Load(p.Uid)
+	if ballot == nil {
+		ballot = ""
+	}
+
+	missing := []string{}
+	for _, m := range g.MissingVotes() {
+		missing = append(missing, m.Uid)
+	}
+
+	return Vote{
+		President: NewPlayer(g, v.OriginPlayer),
+		Candidate: NewPlayer(g, v.DestPlayer),
+		Ballot:    ballot.(string),
+		Missing:   missing,
+	}
+}
+
+func NewResult(r *entities.VoteResult) Result {
+	return Result{Candidate: r.PlayerName, Success: r.Success, Yes: nonNil(r.Yes), No: nonNil(r.No)}
+}
+
+func NewPolicies(p entities.Policies) Policies {
+	return Policies{Liberal: p.Liberal, Fascist: p.Fascist}
+}
+
+func NewHello(g *entities.Game, p *entities.Player) Hello {
+	h := Hello{Game: g.Code, You: NewPlayer(g, p), Policies: NewPolicies(g.Policies())}
+	for _, pl := range g.PlayerList() {
+		h.Players = append(h.Players, NewPlayer(g, pl))
+	}
+
+	if g.Vote != nil {
+		v := NewVote(g, g.Vote, p)
+		h.Vote = &v
+	}
+	if pending := p.PendingResult(); pending != nil {
+		r := NewResult(pending)
+		h.PendingResult = &r
+	}
+	return h
+}
+
+func Reason(r entities.Removal) string {
+	return r.String()
+}
+
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
@@ -0,0 +1,74 @@
+package protocol
+
+import (
+	"time"
+)
+
+// Error codes of the REST api
+const (
+	CodeInvalid      = "invalid"
+	CodeUnauthorized = "unauthorized"
+	CodeForbidden    = "forbidden"
+	CodeNotFound     = "not_found"
+	CodeConflict     = "conflict"
+	CodeUnavailable  = "unavailable"
+	CodeInternal     = "internal"
+)
+
+// Removal reasons, when removing another player over the REST api
+const (
+	ReasonLeft   = "left"
+	ReasonKicked = "kicked"
+	ReasonKilled = "killed"
+	// ReasonRemoved is only sent, when the operator of the server removed the player
+	ReasonRemoved = "removed"
+)
+
+// ErrorBody is the body of a failed request to the REST api
+type ErrorBody struct {
+	Error Error `json:"error"`
+}
+
+// NameRequest starts or joins a game, or renames a player
+type NameRequest struct {
+	Name string `json:"name"`
+}
+
+// Session is the answer to starting or joining a game. Token authenticates all further requests as
+// "Authorization: Bearer <token>", including the websocket.
+type Session struct {
+	Game      string    `json:"game"`
+	Player    Player    `json:"player"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// VoteRequest opens or finishes the vote about whether the candidate becomes chancellor
+type VoteRequest struct {
+	Candidate string `json:"candidate"`
+}
+
+// BallotRequest casts a vote: "yes", "no" or "" to take it back. Candidate guards against voting in a vote
+// that was replaced in the meantime.
+type BallotRequest struct {
+	Candidate string `json:"candidate"`
+	Ballot    string `json:"ballot"`
+}
+
+// FinishVote is the answer to finishing a vote, either the result or the players that have not voted yet
+type FinishVote struct {
+	Finished bool     `json:"finished"`
+	Result   *Result  `json:"result,omitempty"`
+	Missing  []Player `json:"missing,omitempty"`
+}
+
+// PolicyRequest counts a policy laid on the board at the table: "liberal" or "fascist"
+type PolicyRequest struct {
+	Policy string `json:"policy"`
+}
+
+// WebhookRequest registers a webhook for a game. Secret signs the payloads, see the webhooks package.
+type WebhookRequest struct {
+	URL    string `json:"url"`
+	Secret string `json:"secret"`
+}
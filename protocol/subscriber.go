@@ -0,0 +1,90 @@
+package protocol
+
+import (
+	"encoding/json"
+	"github.com/Neifen/secret-h/entities"
+	"github.com/Neifen/secret-h/events"
+	"github.com/Neifen/secret-h/socket"
+	"github.com/gorilla/websocket"
+	"log/slog"
+)
+
+// Translate turns a game event into the message player p receives for it, false if p receives nothing
+func Translate(ev events.Event, p *entities.Player) (Message, bool) {
+	g := ev.Source().Game
+
+	switch e := ev.(type) {
+	case events.Connected:
+		return message(TypeHello, NewHello(g, p)), true
+	case events.PlayerJoined:
+		return message(TypePlayerJoined, PlayerJoined{Player: NewPlayer(g, e.Player)}), true
+	case events.PlayerLeft:
+		return message(TypePlayerLeft, PlayerLeft{Player: NewPlayer(g, e.Player), Reason: Reason(e.Reason)}), true
+	case events.PlayerRenamed:
+		return message(TypePlayerRenamed, PlayerRenamed{Player: NewPlayer(g, e.Player), OldName: e.OldName}), true
+	case events.HostChanged:
+		return message(TypeHostChanged, HostChanged{Host: NewPlayer(g, e.Host)}), true
+	case events.PresenceChanged:
+		return message(TypePresenceChanged, PresenceChanged{Player: NewPlayer(g, e.Player)}), true
+	case events.PlayerMoved:
+		if e.Player.Uid != p.Uid {
+			return Message{}, false
+		}
+		return message(TypeMoved, nil), true
+	case events.VoteOpened:
+		return message(TypeVoteOpened, VoteOpened{Vote: NewVote(g, e.Vote, p)}), true
+	case events.BallotCast:
+		return message(TypeBallotUpdated, BallotUpdated{Player: NewPlayer(g, e.Player), Voted: e.Ballot != "", Vote: NewVote(g, e.Vote, p)}), true
+	case events.VoteFinished:
+		return message(TypeVoteFinished, VoteFinished{Result: NewResult(e.Result)}), true
+	case events.VoteCancelled:
+		return message(TypeVoteCancelled, nil), true
+	case events.PolicyEnacted:
+		return message(TypePolicyEnacted, PolicyEnacted{Policy: string(e.Policy), Policies: NewPolicies(e.Policies)}), true
+	case events.ServerRestarting:
+		return message(TypeRestarting, nil), true
+	case events.Announcement:
+		return message(TypeAnnouncement, Announcement{Text: e.Text}), true
+	}
+	return Message{}, false
+}
+
+// WSSubscriber sends the events of a game as JSON messages to one websocket of player p
+func WSSubscriber(ws socket.Client, p *entities.Player) events.Subscriber {
+	return func(ev events.Event) {
+		msg, ok := Translate(ev, p)
+		if !ok {
+			return
+		}
+
+		err := Send(ws, msg)
+		if err != nil {
+			slog.Debug("could not send to websocket", "err", err)
+			return
+		}
+
+		switch msg.Type {
+		case TypePlayerLeft:
+			if ev.(events.PlayerLeft).Player.Uid == p.Uid {
+				ws.Close(websocket.CloseNormalClosure, "removed from the game")
+			}
+		case TypeMoved:
+			ws.Close(websocket.CloseNormalClosure, "moved to another device")
+		case TypeRestarting:
+			ws.Close(websocket.CloseServiceRestart, "server restarting")
+		}
+	}
+}
+
+// Send writes one message to a JSON websocket
+func Send(ws socket.Client, msg Message) error {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return ws.Send(b)
+}
+
+func message(t string, data any) Message {
+	return Message{Version: Version, Type: t, Data: data}
+}
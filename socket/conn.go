@@ -0,0 +1,95 @@
+package socket
+
+import (
+	"github.com/Neifen/secret-h/metrics"
+	"github.com/gorilla/websocket"
+	"time"
+)
+
+const (
+	// writeWait is how long a single write may take before the client is considered dead
+	writeWait = time.Second * 10
+	// pingPeriod is how often the server checks whether a connection is still alive
+	pingPeriod = time.Second * 10
+	// pongWait is how long a websocket may stay silent before it is considered dead
+	pongWait = time.Minute
+)
+
+var writeErrors = metrics.NewCounter("secreth_websocket_write_errors_total", "Messages and pings that could not be written to a websocket.")
+
+// Conn is a websocket with its own writer goroutine. Gorilla allows only one writer at a time, so every message
+// goes through a bounded queue instead of being written by whoever wants to send something.
+type Conn struct {
+	*queue
+	ws *websocket.Conn
+}
+
+func New(ws *websocket.Conn) *Conn {
+	c := &Conn{ws: ws}
+	c.queue = newQueue(func() {
+		_ = ws.Close()
+	})
+
+	go c.writePump()
+	return c
+}
+
+// Listen reads from the client until the connection ends. onSeen is called on every sign of life,
+// onMessage for every message.
+func (c *Conn) Listen(onSeen func(), onMessage func(msg []byte)) error {
+	_ = c.ws.SetReadDeadline(time.Now().Add(pongWait))
+	c.ws.SetPongHandler(func(string) error {
+		onSeen()
+		return c.ws.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		_, msg, err := c.ws.ReadMessage()
+		if err != nil {
+			c.finish(err)
+			return c.Err()
+		}
+
+		_ = c.ws.SetReadDeadline(time.Now().Add(pongWait))
+		onSeen()
+		onMessage(msg)
+	}
+}
+
+func (c *Conn) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case msg := <-c.send:
+			if err := c.write(msg); err != nil {
+				c.finish(err)
+				return
+			}
+		case <-ticker.C:
+			err := c.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait))
+			if err != nil {
+				writeErrors.Inc()
+				c.finish(err)
+				return
+			}
+		case cf := <-c.closing:
+			c.flush(c.write)
+			_ = c.ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(cf.code, cf.reason), time.Now().Add(writeWait))
+			c.finish(nil)
+			return
+		}
+	}
+}
+
+func (c *Conn) write(msg []byte) error {
+	_ = c.ws.SetWriteDeadline(time.Now().Add(writeWait))
+	err := c.ws.WriteMessage(websocket.TextMessage, msg)
+	if err != nil {
+		writeErrors.Inc()
+	}
+	return err
+}
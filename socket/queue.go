@@ -0,0 +1,110 @@
+package socket
+
+import (
+	"errors"
+	"sync"
+)
+
+// queueSize is how many messages may wait for a slow client before it gets evicted
+const queueSize = 32
+
+var (
+	ErrClosed = errors.New("connection is closed")
+	ErrSlow   = errors.New("client is too slow, send queue is full")
+)
+
+// Client is a connection to a browser or bot that messages can be pushed to
+type Client interface {
+	// Send queues a message for the client
+	Send(msg []byte) error
+	// Close sends the queued messages and ends the connection with a websocket close code and reason
+	Close(code int, reason string)
+}
+
+type closeFrame struct {
+	code   int
+	reason string
+}
+
+// queue is the bounded outbound queue shared by all kinds of clients. Only the writer goroutine of the client
+// takes messages out of it.
+type queue struct {
+	send    chan []byte
+	closing chan closeFrame
+	done    chan struct{}
+
+	once     sync.Once
+	err      error  // why the connection ended, nil if it was closed by us
+	onFinish func() // releases the underlying connection
+}
+
+func newQueue(onFinish func()) *queue {
+	return &queue{
+		send:     make(chan []byte, queueSize),
+		closing:  make(chan closeFrame, 1),
+		done:     make(chan struct{}),
+		onFinish: onFinish,
+	}
+}
+
+// Send queues a message for the client. A client whose queue is full is evicted.
+func (q *queue) Send(msg []byte) error {
+	select {
+	case <-q.done:
+		return ErrClosed
+	default:
+	}
+
+	select {
+	case q.send <- msg:
+		return nil
+	default:
+		q.finish(ErrSlow)
+		return ErrSlow
+	}
+}
+
+// Close sends the queued messages and a close frame, then closes the connection
+func (q *queue) Close(code int, reason string) {
+	select {
+	case q.closing <- closeFrame{code: code, reason: reason}:
+	default:
+		// already closing
+	}
+}
+
+// Done is closed as soon as the connection has ended
+func (q *queue) Done() <-chan struct{} {
+	return q.done
+}
+
+// Err returns why the connection ended. Only valid after Done is closed.
+func (q *queue) Err() error {
+	<-q.done
+	return q.err
+}
+
+// flush writes whatever is still queued, used before closing
+func (q *queue) flush(write func(msg []byte) error) {
+	for {
+		select {
+		case msg := <-q.send:
+			if err := write(msg); err != nil {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+// finish ends the connection, only the first reason is kept
+func (q *queue) finish(err error) {
+	q.once.Do(func() {
+		q.err = err
+		close(q.done)
+		if q.onFinish != nil {
+			q.onFinish()
+		}
+	})
+}
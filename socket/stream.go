@@ -0,0 +1,90 @@
+package socket
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Stream pushes messages to a client as server-sent events, for networks that do not let websockets through
+type Stream struct {
+	*queue
+	w http.ResponseWriter
+	// rc controls the write deadline of the underlying connection
+	rc *http.ResponseController
+}
+
+func NewStream(w http.ResponseWriter) *Stream {
+	return &Stream{queue: newQueue(nil), w: w, rc: http.NewResponseController(w)}
+}
+
+// Serve writes the queued messages until the stream is closed or the client goes away. onSeen is called
+// whenever a keepalive could be delivered.
+func (s *Stream) Serve(ctx context.Context, onSeen func()) error {
+	h := s.w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("X-Accel-Buffering", "no") // no buffering in nginx
+	s.w.WriteHeader(http.StatusOK)
+	if err := s.rc.Flush(); err != nil {
+		s.finish(err)
+		return err
+	}
+
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.finish(ctx.Err())
+			return s.Err()
+		case <-s.done:
+			return s.Err()
+		case msg := <-s.send:
+			if err := s.write("message", msg); err != nil {
+				s.finish(err)
+				return err
+			}
+		case <-ticker.C:
+			if err := s.write("", nil); err != nil {
+				s.finish(err)
+				return err
+			}
+			onSeen()
+		case cf := <-s.closing:
+			s.flush(func(msg []byte) error {
+				return s.write("message", msg)
+			})
+			// EventSource reconnects on its own, this tells the client not to
+			_ = s.write("close", []byte(fmt.Sprintf("%d %s", cf.code, cf.reason)))
+			s.finish(nil)
+			return nil
+		}
+	}
+}
+
+// write sends one event, an empty event is sent as comment to keep the connection alive
+func (s *Stream) write(event string, msg []byte) error {
+	_ = s.rc.SetWriteDeadline(time.Now().Add(writeWait))
+
+	var buf bytes.Buffer
+	if event == "" {
+		buf.WriteString(": keepalive\n\n")
+	} else {
+		fmt.Fprintf(&buf, "event: %s\n", event)
+		for _, line := range bytes.Split(msg, []byte("\n")) {
+			buf.WriteString("data: ")
+			buf.Write(line)
+			buf.WriteString("\n")
+		}
+		buf.WriteString("\n")
+	}
+
+	if _, err := s.w.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
@@ -0,0 +1,368 @@
+// Package tui is a terminal client for Secret-H, in the same green-on-black look as the browser.
+// It is driven by the JSON websocket, typed commands followed by enter act on the game.
+package tui
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/Neifen/secret-h/client"
+	"github.com/Neifen/secret-h/entities"
+	"github.com/Neifen/secret-h/protocol"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	clear  = "\033[H\033[2J"
+	green  = "\033[32m"
+	bright = "\033[92m"
+	dim    = "\033[2m"
+	reset  = "\033[0m"
+
+	// reconnectDelay is how long to wait before reconnecting to a restarting server
+	reconnectDelay = time.Second * 2
+	// maxReconnects is how often reconnecting is tried before giving up
+	maxReconnects = 10
+)
+
+// Options of the terminal client
+type Options struct {
+	Server string // e.g. http://localhost:8148
+	Code   string // game to join, a new game is started if empty
+	Name   string
+}
+
+type tui struct {
+	c   *client.Client
+	out io.Writer
+
+	game     string
+	you      protocol.Player
+	players  []protocol.Player
+	vote     *protocol.Vote
+	result   *protocol.Result
+	missing  []protocol.Player // players the president is waiting for
+	policies protocol.Policies
+	message  string
+	done     string // why the client stopped, empty while running
+}
+
+// Run joins or starts a game and plays it in the terminal until the player quits or leaves the game
+func Run(ctx context.Context, opts Options, in io.Reader, out io.Writer) error {
+	t := &tui{c: client.New(opts.Server), out: out}
+
+	var err error
+	if opts.Code == "" {
+		_, err = t.c.StartGame(ctx, opts.Name)
+	} else {
+		_, err = t.c.JoinGame(ctx, opts.Code, opts.Name)
+	}
+	if err != nil {
+		return err
+	}
+
+	lines := make(chan string)
+	go func() {
+		sc := bufio.NewScanner(in)
+		for sc.Scan() {
+			lines <- strings.TrimSpace(sc.Text())
+		}
+		close(lines)
+	}()
+
+	return t.loop(ctx, lines)
+}
+
+func (t *tui) loop(ctx context.Context, lines <-chan string) error {
+	reconnects := 0
+	for {
+		sub, err := t.c.Subscribe(ctx)
+		if err != nil {
+			return err
+		}
+
+		err = t.play(ctx, sub, lines)
+		_ = sub.Close()
+		if t.done != "" {
+			t.render()
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if !client.Restarting(sub.Err()) || reconnects >= maxReconnects {
+			return fmt.Errorf("connection lost: %v", sub.Err())
+		}
+		reconnects++
+		t.message = "Server restarting, reconnecting shortly..."
+		t.render()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+// play handles events and input until the subscription ends or the client is done
+func (t *tui) play(ctx context.Context, sub *client.Subscription, lines <-chan string) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case ev, ok := <-sub.Events():
+			if !ok {
+				return nil
+			}
+			t.handle(ev)
+		case line, ok := <-lines:
+			if !ok {
+				t.done = "Bye"
+				return nil
+			}
+			t.message = ""
+			t.command(ctx, sub, line)
+		}
+
+		if t.done != "" {
+			return nil
+		}
+		t.render()
+	}
+}
+
+func (t *tui) handle(ev any) {
+	switch e := ev.(type) {
+	case protocol.Hello:
+		t.game = e.Game
+		t.you = e.You
+		t.players = e.Players
+		t.vote = e.Vote
+		t.result = e.PendingResult
+		t.missing = nil
+		t.policies = e.Policies
+	case protocol.PlayerJoined:
+		t.players = append(t.players, e.Player)
+	case protocol.PlayerLeft:
+		if e.Player.Id == t.you.Id && e.Reason == protocol.ReasonLeft {
+			t.done = "You left the game"
+			return
+		}
+		if e.Player.Id == t.you.Id {
+			t.done = fmt.Sprintf("You were %v", e.Reason)
+			return
+		}
+		t.removePlayer(e.Player.Id)
+		t.message = fmt.Sprintf("%v %v", e.Player.Name, e.Reason)
+	case protocol.PlayerRenamed:
+		t.updatePlayer(e.Player)
+	case protocol.HostChanged:
+		for i := range t.players {
+			t.players[i].Host = t.players[i].Id == e.Host.Id
+		}
+		t.you.Host = t.you.Id == e.Host.Id
+	case protocol.PresenceChanged:
+		t.updatePlayer(e.Player)
+	case protocol.Moved:
+		t.done = "You continued this game on another device"
+	case protocol.VoteOpened:
+		t.vote = &e.Vote
+		t.result = nil
+	case protocol.BallotUpdated:
+		t.vote = &e.Vote
+		if t.missing != nil {
+			t.missing = t.stillMissing(e.Vote.Missing)
+		}
+	case protocol.VoteFinished:
+		t.vote = nil
+		t.missing = nil
+		t.result = &e.Result
+	case protocol.VoteCancelled:
+		t.vote = nil
+		t.missing = nil
+		t.message = "Vote cancelled"
+	case protocol.PolicyEnacted:
+		t.policies = e.Policies
+		t.message = fmt.Sprintf("A %v policy was enacted", e.Policy)
+	case protocol.VoteWaiting:
+		t.missing = e.Missing
+	case protocol.Announcement:
+		t.message = "Message from the admin: " + e.Text
+	case protocol.Error:
+		t.message = "Error: " + e.Message
+	}
+}
+
+// command runs what the player typed
+func (t *tui) command(ctx context.Context, sub *client.Subscription, line string) {
+	cmd, arg, _ := strings.Cut(line, " ")
+
+	var err error
+	switch {
+	case cmd == "q":
+		t.done = "Bye"
+	case cmd == "leave":
+		err = t.c.Leave(ctx)
+	case t.result != nil && cmd == "":
+		err = sub.AckResult()
+		t.result = nil
+	case t.vote != nil && (cmd == "y" || cmd == "n" || cmd == "-"):
+		ballot := map[string]string{"y": "yes", "n": "no", "-": ""}[cmd]
+		err = sub.Cast(t.vote.Candidate.Id, ballot)
+	case t.vote != nil && cmd == "f":
+		err = sub.FinishVote(t.vote.Candidate.Id)
+	case t.vote != nil && cmd == "c":
+		err = sub.CancelVote()
+	case t.vote == nil && cmd == "v":
+		var p protocol.Player
+		p, err = t.playerAt(arg)
+		if err == nil {
+			_, err = t.c.OpenVote(ctx, p.Id)
+		}
+	case t.you.Host && (cmd == "lib" || cmd == "fas"):
+		policy := map[string]string{"lib": "liberal", "fas": "fascist"}[cmd]
+		_, err = t.c.EnactPolicy(ctx, policy)
+	case cmd == "":
+	default:
+		err = fmt.Errorf("unknown command %q", line)
+	}
+
+	if err != nil {
+		t.message = "Error: " + err.Error()
+	}
+}
+
+func (t *tui) render() {
+	var b strings.Builder
+	b.WriteString(clear + green)
+	fmt.Fprintf(&b, "%vSecret-H%v%v   > Lobby Code: %v\n\n", bright, reset, green, t.game)
+
+	b.WriteString("> Players\n")
+	for i, p := range t.players {
+		marker := " "
+		if p.Id == t.you.Id {
+			marker = ">"
+		}
+		fmt.Fprintf(&b, " %v %d. %v", marker, i+1, p.Name)
+		if p.Host {
+			b.WriteString(" [host]")
+		}
+		if p.Id != t.you.Id && p.Presence != "online" {
+			fmt.Fprintf(&b, "%v [%v]%v%v", dim, p.Presence, reset, green)
+		}
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "\n> Policies: liberal %d/%d, fascist %d/%d\n\n", t.policies.Liberal, entities.MaxLiberal, t.policies.Fascist, entities.MaxFascist)
+
+	switch {
+	case t.done != "":
+		fmt.Fprintf(&b, "> %v\n", t.done)
+	case t.result != nil:
+		t.renderResult(&b)
+	case t.vote != nil:
+		t.renderVote(&b)
+	default:
+		b.WriteString("[v <nr>] vote for chancellor  [leave] leave game  [q] quit\n")
+		if t.you.Host {
+			b.WriteString("[lib] / [fas] count an enacted liberal / fascist policy\n")
+		}
+	}
+
+	if t.message != "" {
+		fmt.Fprintf(&b, "\n> %v\n", t.message)
+	}
+	b.WriteString(reset)
+	if t.done == "" {
+		b.WriteString(bright + "> " + reset)
+	}
+	_, _ = io.WriteString(t.out, b.String())
+}
+
+func (t *tui) renderVote(b *strings.Builder) {
+	v := t.vote
+	fmt.Fprintf(b, "%v> Vote for %v to be Chancellor%v%v\n", bright, v.Candidate.Name, reset, green)
+	fmt.Fprintf(b, "  President: %v\n", v.President.Name)
+
+	yes, no := "  JA!  ", "  NEIN!  "
+	switch v.Ballot {
+	case "yes":
+		yes = "[ JA! ]"
+	case "no":
+		no = "[ NEIN! ]"
+	}
+	fmt.Fprintf(b, "  %v   %v\n", yes, no)
+	fmt.Fprintf(b, "  %d of %d still have to vote\n\n", len(v.Missing), len(t.players))
+
+	if t.missing != nil {
+		b.WriteString("> Waiting for the following players:\n")
+		for _, p := range t.missing {
+			fmt.Fprintf(b, "  > %v\n", p.Name)
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString("[y] ja  [n] nein  [-] take back")
+	if v.President.Id == t.you.Id {
+		b.WriteString("  [f] finish  [c] cancel")
+	}
+	b.WriteString("\n")
+}
+
+func (t *tui) renderResult(b *strings.Builder) {
+	r := t.result
+	fmt.Fprintf(b, "> Yes Votes: %v (%v)\n", len(r.Yes), strings.Join(r.Yes, ", "))
+	fmt.Fprintf(b, "> No Votes: %v (%v)\n", len(r.No), strings.Join(r.No, ", "))
+	if r.Success {
+		fmt.Fprintf(b, "%v> Vote was successfull, %v is now chancellor.%v%v\n", bright, r.Candidate, reset, green)
+	} else {
+		fmt.Fprintf(b, "%v> Vote failed, %v is not chancellor.%v%v\n", bright, r.Candidate, reset, green)
+	}
+	b.WriteString("[enter] VERSTANDEN\n")
+}
+
+// playerAt finds a player by the number shown in the list
+func (t *tui) playerAt(arg string) (protocol.Player, error) {
+	i, err := strconv.Atoi(arg)
+	if err != nil || i < 1 || i > len(t.players) {
+		return protocol.Player{}, fmt.Errorf("no player number %q", arg)
+	}
+	return t.players[i-1], nil
+}
+
+func (t *tui) updatePlayer(p protocol.Player) {
+	for i := range t.players {
+		if t.players[i].Id == p.Id {
+			t.players[i] = p
+		}
+	}
+	if p.Id == t.you.Id {
+		t.you = p
+	}
+}
+
+func (t *tui) removePlayer(id string) {
+	for i, p := range t.players {
+		if p.Id == id {
+			t.players = append(t.players[:i], t.players[i+1:]...)
+			return
+		}
+	}
+}
+
+// stillMissing keeps the players of the wait list that are still in missing
+func (t *tui) stillMissing(missing []string) []protocol.Player {
+	left := []protocol.Player{}
+	for _, p := range t.players {
+		for _, id := range missing {
+			if p.Id == id {
+				left = append(left, p)
+			}
+		}
+	}
+	return left
+}
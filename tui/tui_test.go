@@ -0,0 +1,132 @@
+package tui_test
+
+import (
+	"context"
+	"github.com/Neifen/secret-h/api"
+	"github.com/Neifen/secret-h/client"
+	"github.com/Neifen/secret-h/config"
+	"github.com/Neifen/secret-h/protocol"
+	"github.com/Neifen/secret-h/tui"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// screen collects what the client draws
+type screen struct {
+	mu   sync.Mutex
+	b    strings.Builder
+	seen int // waitFor only looks at what was drawn after its last match
+}
+
+func (s *screen) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.Write(p)
+}
+
+// waitFor waits until text is drawn
+func (s *screen) waitFor(t *testing.T, text string) {
+	t.Helper()
+	timeout := time.Now().Add(5 * time.Second)
+	for time.Now().Before(timeout) {
+		s.mu.Lock()
+		drawn := s.b.String()[s.seen:]
+		i := strings.Index(drawn, text)
+		if i >= 0 {
+			s.seen += i + len(text)
+		}
+		s.mu.Unlock()
+
+		if i >= 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("%q was not drawn", text)
+}
+
+func TestJoinVoteQuit(t *testing.T) {
+	srv := httptest.NewServer(api.NewSession(config.Config{GameTTL: time.Hour, QRLevel: "medium", LogLevel: "error", LogFormat: "text"}).Handler())
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	host := client.New(srv.URL)
+	game, err := host.StartGame(ctx, "Max")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostSub, err := host.Subscribe(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hostSub.Close()
+
+	in, typing := io.Pipe()
+	enter := func(line string) {
+		t.Helper()
+		if _, err := io.WriteString(typing, line+"\n"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out := &screen{}
+	done := make(chan error, 1)
+	go func() {
+		done <- tui.Run(ctx, tui.Options{Server: srv.URL, Code: game.Game, Name: "Eva"}, in, out)
+	}()
+
+	out.waitFor(t, "Lobby Code: "+game.Game)
+	out.waitFor(t, "2. Eva")
+
+	// eva proposes max, both vote yes and eva finishes the vote
+	enter("v 1")
+	out.waitFor(t, "Vote for Max to be Chancellor")
+	enter("y")
+	out.waitFor(t, "[ JA! ]")
+	if _, err := host.Cast(ctx, game.Player.Id, "yes"); err != nil {
+		t.Fatal(err)
+	}
+	out.waitFor(t, "0 of 2 still have to vote")
+	enter("f")
+	out.waitFor(t, "Vote was successfull, Max is now chancellor.")
+	if finished := nextFinished(t, hostSub); len(finished.Result.Yes) != 2 {
+		t.Fatalf("vote finished %+v", finished)
+	}
+
+	enter("")
+	out.waitFor(t, "[v <nr>] vote for chancellor")
+	enter("bogus")
+	out.waitFor(t, `Error: unknown command "bogus"`)
+
+	enter("q")
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("did not quit")
+	}
+	out.waitFor(t, "> Bye")
+}
+
+func nextFinished(t *testing.T, sub *client.Subscription) protocol.VoteFinished {
+	t.Helper()
+	for {
+		select {
+		case ev, ok := <-sub.Events():
+			if !ok {
+				t.Fatalf("subscription ended: %v", sub.Err())
+			}
+			if e, ok := ev.(protocol.VoteFinished); ok {
+				return e
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("no vote finished")
+		}
+	}
+}
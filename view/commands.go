@@ -0,0 +1,13 @@
+package view
+
+import (
+	"encoding/json"
+	"github.com/Neifen/secret-h/protocol"
+)
+
+// wsCommand is the data-ws-command of a button: while the websocket is open, the button sends this command over
+// it instead of making its POST request
+func wsCommand(typ, candidate, ballot string) string {
+	b, _ := json.Marshal(protocol.Command{Type: typ, Candidate: candidate, Ballot: ballot})
+	return string(b)
+}
@@ -31,7 +31,33 @@ func home() templ.Component {
 			templ_7745c5c3_Var1 = templ.NopComponent
 		}
 		ctx = templ.ClearChildren(ctx)
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 1, "<div class=\"w-full max-w-md bg-gray-800 rounded-lg shadow-lg p-6 border border-green-500/30\"><h1 class=\"text-2xl font-bold text-center text-green-400 mb-6 tracking-wider\">Welcome to Secret-H</h1><form><div class=\"mb-6\"><label for=\"name\" class=\"block text-sm text-green-300 mb-2\">> Name (required)</label> <input type=\"text\" id=\"name\" name=\"name\" required class=\"w-full p-3 bg-gray-900 border border-green-500/50 rounded-md text-green-300 focus:outline-none focus:ring-2 focus:ring-green-500 placeholder-green-700/50\"></div><div class=\"mb-6\"><label for=\"code\" class=\"block text-sm text-green-300 mb-2\">> Join game</label> <input type=\"text\" name=\"code\" id=\"code\" placeholder=\"Enter game code\" class=\"w-full p-3 bg-gray-900 border border-green-500/50 rounded-md text-green-300 focus:outline-none focus:ring-2 focus:ring-green-500 placeholder-green-700/50\"></div><div class=\"mb-6\"><button id=\"start-button\" hx-post=\"/start\" hx-swap=\"none\" class=\"w-full bg-green-500/20 text-green-300 p-3 rounded-md border border-green-500/50 hover:bg-green-500/40 transition-colors\">> Start New Game</button> <button hidden id=\"join-button\" hx-post=\"/join\" hx-swap=\"none\" class=\"w-full bg-green-500/20 text-green-300 p-3 rounded-md border border-green-500/50 hover:bg-green-500/40 transition-colors\">> Join Game</button></div><script>\n                        const code = document.getElementById('code');\n                        const joinButton = document.getElementById('join-button');\n                        const startButton = document.getElementById('start-button');\n                        \n                        // needs to happen on loan\n                        if(code.value.length > 0) {\n                            startButton.setAttribute(\"hidden\", \"true\")\n                            joinButton.removeAttribute(\"hidden\")\n\n                        } else {\n                            joinButton.setAttribute(\"hidden\", \"true\")\n                            startButton.removeAttribute(\"hidden\")\n                        }\n                        \n                        // and a listener\n                        code.addEventListener('input', function() {\n                            if(code.value.length > 0) {\n                                startButton.setAttribute(\"hidden\", \"true\")\n                                joinButton.removeAttribute(\"hidden\")\n                            } else {\n                                joinButton.setAttribute(\"hidden\", \"true\")\n                                startButton.removeAttribute(\"hidden\")\n                            }\n                        });\n                    </script></form></div>")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 1, "<div class=\"w-full max-w-md bg-gray-800 rounded-lg shadow-lg p-6 border border-green-500/30\"><h1 class=\"text-2xl font-bold text-center text-green-400 mb-6 tracking-wider\">Welcome to Secret-H</h1><form><div class=\"mb-6\"><label for=\"name\" class=\"block text-sm text-green-300 mb-2\">> Name (required)</label> <input type=\"text\" id=\"name\" name=\"name\" required class=\"w-full p-3 bg-gray-900 border border-green-500/50 rounded-md text-green-300 focus:outline-none focus:ring-2 focus:ring-green-500 placeholder-green-700/50\"></div><div class=\"mb-6\"><label for=\"code\" class=\"block text-sm text-green-300 mb-2\">> Join game</label> <input type=\"text\" name=\"code\" id=\"code\" placeholder=\"Enter game code\" class=\"w-full p-3 bg-gray-900 border border-green-500/50 rounded-md text-green-300 focus:outline-none focus:ring-2 focus:ring-green-500 placeholder-green-700/50\"></div><div class=\"mb-6\"><button id=\"start-button\" hx-post=\"")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		var templ_7745c5c3_Var2 string
+		templ_7745c5c3_Var2, templ_7745c5c3_Err = templ.JoinStringErrs(Path("/start"))
+		if templ_7745c5c3_Err != nil {
+			return templ.Error{Err: templ_7745c5c3_Err, FileName: `view/home.templ`, Line: 18, Col: 54}
+		}
+		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var2))
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 2, "\" hx-swap=\"none\" class=\"w-full bg-green-500/20 text-green-300 p-3 rounded-md border border-green-500/50 hover:bg-green-500/40 transition-colors\">> Start New Game</button> <button hidden id=\"join-button\" hx-post=\"")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		var templ_7745c5c3_Var3 string
+		templ_7745c5c3_Var3, templ_7745c5c3_Err = templ.JoinStringErrs(Path("/join"))
+		if templ_7745c5c3_Err != nil {
+			return templ.Error{Err: templ_7745c5c3_Err, FileName: `view/home.templ`, Line: 19, Col: 59}
+		}
+		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var3))
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 3, "\" hx-swap=\"none\" class=\"w-full bg-green-500/20 text-green-300 p-3 rounded-md border border-green-500/50 hover:bg-green-500/40 transition-colors\">> Join Game</button></div><script>\n                        const code = document.getElementById('code');\n                        const joinButton = document.getElementById('join-button');\n                        const startButton = document.getElementById('start-button');\n                        \n                        // needs to happen on loan\n                        if(code.value.length > 0) {\n                            startButton.setAttribute(\"hidden\", \"true\")\n                            joinButton.removeAttribute(\"hidden\")\n\n                        } else {\n                            joinButton.setAttribute(\"hidden\", \"true\")\n                            startButton.removeAttribute(\"hidden\")\n                        }\n                        \n                        // and a listener\n                        code.addEventListener('input', function() {\n                            if(code.value.length > 0) {\n                                startButton.setAttribute(\"hidden\", \"true\")\n                                joinButton.removeAttribute(\"hidden\")\n                            } else {\n                                joinButton.setAttribute(\"hidden\", \"true\")\n                                startButton.removeAttribute(\"hidden\")\n                            }\n                        });\n                    </script></form></div>")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
@@ -59,12 +85,12 @@ func viewHome() templ.Component {
 			}()
 		}
 		ctx = templ.InitializeContext(ctx)
-		templ_7745c5c3_Var2 := templ.GetChildren(ctx)
-		if templ_7745c5c3_Var2 == nil {
-			templ_7745c5c3_Var2 = templ.NopComponent
+		templ_7745c5c3_Var4 := templ.GetChildren(ctx)
+		if templ_7745c5c3_Var4 == nil {
+			templ_7745c5c3_Var4 = templ.NopComponent
 		}
 		ctx = templ.ClearChildren(ctx)
-		templ_7745c5c3_Var3 := templruntime.GeneratedTemplate(func(templ_7745c5c3_Input templruntime.GeneratedComponentInput) (templ_7745c5c3_Err error) {
+		templ_7745c5c3_Var5 := templruntime.GeneratedTemplate(func(templ_7745c5c3_Input templruntime.GeneratedComponentInput) (templ_7745c5c3_Err error) {
 			templ_7745c5c3_W, ctx := templ_7745c5c3_Input.Writer, templ_7745c5c3_Input.Context
 			templ_7745c5c3_Buffer, templ_7745c5c3_IsBuffer := templruntime.GetBuffer(templ_7745c5c3_W)
 			if !templ_7745c5c3_IsBuffer {
@@ -82,7 +108,7 @@ func viewHome() templ.Component {
 			}
 			return nil
 		})
-		templ_7745c5c3_Err = base().Render(templ.WithChildren(ctx, templ_7745c5c3_Var3), templ_7745c5c3_Buffer)
+		templ_7745c5c3_Err = base().Render(templ.WithChildren(ctx, templ_7745c5c3_Var5), templ_7745c5c3_Buffer)
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
@@ -9,7 +9,8 @@ import "github.com/a-h/templ"
 import templruntime "github.com/a-h/templ/runtime"
 
 import "fmt"
-import "github.com/gorilla/websocket"
+import "log/slog"
+import "github.com/Neifen/secret-h/socket"
 
 func removePlayer(pid string) templ.Component {
 	return templruntime.GeneratedTemplate(func(templ_7745c5c3_Input templruntime.GeneratedComponentInput) (templ_7745c5c3_Err error) {
@@ -40,7 +41,7 @@ func removePlayer(pid string) templ.Component {
 		var templ_7745c5c3_Var2 string
 		templ_7745c5c3_Var2, templ_7745c5c3_Err = templ.JoinStringErrs(swap)
 		if templ_7745c5c3_Err != nil {
-			return templ.Error{Err: templ_7745c5c3_Err, FileName: `view/lobby_remove_player.templ`, Line: 8, Col: 29}
+			return templ.Error{Err: templ_7745c5c3_Err, FileName: `view/lobby_remove_player.templ`, Line: 9, Col: 29}
 		}
 		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var2))
 		if templ_7745c5c3_Err != nil {
@@ -54,10 +55,10 @@ func removePlayer(pid string) templ.Component {
 	})
 }
 
-func WSRenderRemovePlayer(ws *websocket.Conn, pid string) {
+func WSRenderRemovePlayer(ws socket.Client, pid string) {
 	err := renderWebsocket(ws, removePlayer(pid))
 	if err != nil {
-		fmt.Println("Websocket error: ", err.Error())
+		slog.Debug("could not send to websocket", "err", err)
 	}
 }
 
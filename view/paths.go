@@ -0,0 +1,19 @@
+package view
+
+import "fmt"
+
+// basePath prefixes every link of the pages, it is set once before the server starts
+var basePath string
+
+// SetBasePath serves the pages below a prefix like /secret-h, which has no trailing slash
+func SetBasePath(p string) {
+	basePath = p
+}
+
+// Path formats a path of the server below the base path, e.g. Path("/lobby/%s", gid)
+func Path(format string, args ...any) string {
+	if len(args) == 0 {
+		return basePath + format
+	}
+	return basePath + fmt.Sprintf(format, args...)
+}
@@ -3,15 +3,23 @@ package view
 import (
 	"bytes"
 	"context"
+	"github.com/Neifen/secret-h/socket"
 	"github.com/a-h/templ"
-	"github.com/gorilla/websocket"
 	"github.com/labstack/echo/v4"
+	"log/slog"
 )
 
 func ClosePopup(c echo.Context) error {
 	return renderView(c, closePopup())
 }
 
+func WSClosePopup(ws socket.Client) {
+	err := renderWebsocket(ws, closePopup())
+	if err != nil {
+		slog.Debug("could not send to websocket", "err", err)
+	}
+}
+
 func renderView(c echo.Context, cmp templ.Component) error {
 	c.Response().Header().Set(echo.HeaderContentType, echo.MIMETextHTML)
 
@@ -24,7 +32,7 @@ func renderView(c echo.Context, cmp templ.Component) error {
 	return cmp.Render(c.Request().Context(), c.Response().Writer)
 }
 
-func renderWebsocket(ws *websocket.Conn, cmp templ.Component) error {
+func renderWebsocket(ws socket.Client, cmp templ.Component) error {
 	//c.Response().Header().Set(echo.HeaderContentType, echo.MIMETextHTML)
 
 	var buf bytes.Buffer
@@ -32,9 +40,5 @@ func renderWebsocket(ws *websocket.Conn, cmp templ.Component) error {
 	if err != nil {
 		return err
 	}
-	err = ws.WriteMessage(websocket.TextMessage, buf.Bytes())
-	if err != nil {
-		return err
-	}
-	return nil
+	return ws.Send(buf.Bytes())
 }
@@ -0,0 +1,117 @@
+package view
+
+import (
+	"github.com/Neifen/secret-h/entities"
+	"github.com/Neifen/secret-h/events"
+	"github.com/Neifen/secret-h/socket"
+	"github.com/gorilla/websocket"
+)
+
+// WSSubscriber renders the events of a game into htmx fragments for one websocket or event stream of player p
+func WSSubscriber(ws socket.Client, p *entities.Player) events.Subscriber {
+	return func(ev events.Event) {
+		g := ev.Source().Game
+
+		switch e := ev.(type) {
+		case events.Connected:
+			syncPlayer(ws, g, p)
+		case events.PlayerJoined:
+			if e.Player.Uid != p.Uid {
+				WSRenderNewPlayer(ws, g, p, e.Player)
+			}
+		case events.PlayerLeft:
+			if e.Player.Uid != p.Uid {
+				WSRenderRemovePlayer(ws, e.Player.Uid)
+				return
+			}
+
+			switch e.Reason {
+			case entities.Killed:
+				WSRenderRemovedPopup(ws)
+			case entities.Kicked:
+				WSRenderKickedPopup(ws, "The host has removed you from this game")
+			case entities.Removed:
+				WSRenderKickedPopup(ws, "An admin has removed you from this game")
+			}
+			ws.Close(websocket.CloseNormalClosure, "removed from the game")
+		case events.PlayerRenamed:
+			WSRenderPlayerList(ws, g, g.PlayerList(), p)
+		case events.HostChanged:
+			WSRenderPlayerList(ws, g, g.PlayerList(), p)
+			// only the host has the buttons to enact policies
+			WSRenderPolicies(ws, g, p)
+		case events.PolicyEnacted:
+			WSRenderPolicies(ws, g, p)
+		case events.PresenceChanged:
+			if e.Player.Uid != p.Uid {
+				WSRenderPresence(ws, e.Player)
+			}
+		case events.PlayerMoved:
+			if e.Player.Uid == p.Uid {
+				WSRenderMovedPopup(ws)
+				ws.Close(websocket.CloseNormalClosure, "moved to another device")
+			}
+		case events.VoteOpened:
+			// the president already got the vote as answer to opening it
+			if e.Vote.OriginPlayer.Uid != p.Uid {
+				WsRenderVote(ws, false, g.Code, "", e.Vote.DestPlayer)
+			}
+		case events.BallotCast:
+			if e.Vote.Waiting && e.Vote.OriginPlayer.Uid == p.Uid {
+				renderWaitUpdate(ws, g, e)
+			}
+		case events.VoteFinished:
+			// president gets this double, oh well
+			WsRenderAfterVote(ws, g.Code, e.Result)
+		case events.VoteCancelled:
+			WsRenderCancelVote(ws)
+		case events.Announcement:
+			WSRenderAnnouncement(ws, e.Text)
+		case events.ServerRestarting:
+			// htmx reconnects on its own after a service restart
+			WSRenderRestartingPopup(ws)
+			ws.Close(websocket.CloseServiceRestart, "server restarting")
+		}
+	}
+}
+
+// renderWaitUpdate keeps the wait screen of the president up to date
+func renderWaitUpdate(ws socket.Client, g *entities.Game, e events.BallotCast) {
+	if e.Ballot == "" {
+		WSRenderAddPlayerWait(ws, e.Player)
+		WSRenderRemoveTryAgainWait(ws, g.Code, e.Vote.DestPlayer.Uid)
+		return
+	}
+
+	WSRenderRemovePlayerWait(ws, e.Player)
+	if len(g.MissingVotes()) == 0 {
+		WSRenderAddTryAgainWait(ws, g.Code, e.Vote.DestPlayer.Uid)
+	}
+}
+
+// syncPlayer brings a (re)connected player up to date with everything that happened while they were offline
+func syncPlayer(ws socket.Client, g *entities.Game, p *entities.Player) {
+	WSRenderPlayerList(ws, g, g.PlayerList(), p)
+	WSRenderPolicies(ws, g, p)
+
+	v := g.Vote
+	pending := p.PendingResult()
+	switch {
+	case v != nil && v.Waiting && v.OriginPlayer.Uid == p.Uid:
+		empty := g.MissingVotes()
+		WSRenderVoteWaitPopup(ws, empty, g.Code, v.DestPlayer.Uid)
+		if len(empty) == 0 {
+			WSRenderAddTryAgainWait(ws, g.Code, v.DestPlayer.Uid)
+		}
+	case v != nil:
+		// empty for a player who joined during the vote
+		toggled, _ := v.Votes.Load(p.Uid)
+		ballot, _ := toggled.(string)
+		WsRenderVote(ws, v.OriginPlayer.Uid == p.Uid, g.Code, ballot, v.DestPlayer)
+	case pending != nil:
+		WsRenderAfterVote(ws, g.Code, pending)
+	default:
+		// whatever was open might be outdated
+		WsRenderCancelVote(ws)
+	}
+}
@@ -9,13 +9,14 @@ import "github.com/a-h/templ"
 import templruntime "github.com/a-h/templ/runtime"
 
 import (
-	"fmt"
 	"github.com/Neifen/secret-h/entities"
-	"github.com/gorilla/websocket"
+	"github.com/Neifen/secret-h/protocol"
+	"github.com/Neifen/secret-h/socket"
 	"github.com/labstack/echo/v4"
+	"log/slog"
 )
 
-func vote(president bool, gid, toggled, originPid string, destP *entities.Player) templ.Component {
+func vote(president bool, gid, toggled string, destP *entities.Player) templ.Component {
 	return templruntime.GeneratedTemplate(func(templ_7745c5c3_Input templruntime.GeneratedComponentInput) (templ_7745c5c3_Err error) {
 		templ_7745c5c3_W, ctx := templ_7745c5c3_Input.Writer, templ_7745c5c3_Input.Context
 		if templ_7745c5c3_CtxErr := ctx.Err(); templ_7745c5c3_CtxErr != nil {
@@ -41,9 +42,9 @@ func vote(president bool, gid, toggled, originPid string, destP *entities.Player
 			return templ_7745c5c3_Err
 		}
 		var templ_7745c5c3_Var2 string
-		templ_7745c5c3_Var2, templ_7745c5c3_Err = templ.JoinStringErrs(destP.Name)
+		templ_7745c5c3_Var2, templ_7745c5c3_Err = templ.JoinStringErrs(destP.Name())
 		if templ_7745c5c3_Err != nil {
-			return templ.Error{Err: templ_7745c5c3_Err, FileName: `view/vote.templ`, Line: 15, Col: 108}
+			return templ.Error{Err: templ_7745c5c3_Err, FileName: `view/vote.templ`, Line: 16, Col: 110}
 		}
 		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var2))
 		if templ_7745c5c3_Err != nil {
@@ -53,7 +54,7 @@ func vote(president bool, gid, toggled, originPid string, destP *entities.Player
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
-		templ_7745c5c3_Err = voteButton(gid, toggled, originPid, destP).Render(ctx, templ_7745c5c3_Buffer)
+		templ_7745c5c3_Err = voteButton(gid, toggled, destP).Render(ctx, templ_7745c5c3_Buffer)
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
@@ -62,8 +63,8 @@ func vote(president bool, gid, toggled, originPid string, destP *entities.Player
 			return templ_7745c5c3_Err
 		}
 		if president {
-			finishUrl := fmt.Sprintf("/finish-vote/%s/%s/%s", gid, originPid, destP.Uid)
-			cancelUrl := fmt.Sprintf("/cancel-vote/%s", gid)
+			finishUrl := Path("/finish-vote/%s/%s", gid, destP.Uid)
+			cancelUrl := Path("/cancel-vote/%s", gid)
 			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 4, "<button hx-post=\"")
 			if templ_7745c5c3_Err != nil {
 				return templ_7745c5c3_Err
@@ -71,31 +72,57 @@ func vote(president bool, gid, toggled, originPid string, destP *entities.Player
 			var templ_7745c5c3_Var3 string
 			templ_7745c5c3_Var3, templ_7745c5c3_Err = templ.JoinStringErrs(finishUrl)
 			if templ_7745c5c3_Err != nil {
-				return templ.Error{Err: templ_7745c5c3_Err, FileName: `view/vote.templ`, Line: 23, Col: 42}
+				return templ.Error{Err: templ_7745c5c3_Err, FileName: `view/vote.templ`, Line: 24, Col: 42}
 			}
 			_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var3))
 			if templ_7745c5c3_Err != nil {
 				return templ_7745c5c3_Err
 			}
-			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 5, "\" class=\"bg-green-500/20 text-green-300 px-4 py-2 rounded-md border border-green-500/50 hover:bg-green-500/40 transition-colors\">> Ready</button> <button hx-post=\"")
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 5, "\" data-ws-command=\"")
 			if templ_7745c5c3_Err != nil {
 				return templ_7745c5c3_Err
 			}
 			var templ_7745c5c3_Var4 string
-			templ_7745c5c3_Var4, templ_7745c5c3_Err = templ.JoinStringErrs(cancelUrl)
+			templ_7745c5c3_Var4, templ_7745c5c3_Err = templ.JoinStringErrs(wsCommand(protocol.CommandFinishVote, destP.Uid, ""))
 			if templ_7745c5c3_Err != nil {
-				return templ.Error{Err: templ_7745c5c3_Err, FileName: `view/vote.templ`, Line: 24, Col: 42}
+				return templ.Error{Err: templ_7745c5c3_Err, FileName: `view/vote.templ`, Line: 24, Col: 113}
 			}
 			_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var4))
 			if templ_7745c5c3_Err != nil {
 				return templ_7745c5c3_Err
 			}
-			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 6, "\" class=\"text-green-300 text-sm bg-gray-900/50 px-4 py-2 rounded-md border border-green-500/30 hover:bg-green-500/20 transition-colors\">> Cancel</button>")
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 6, "\" class=\"bg-green-500/20 text-green-300 px-4 py-2 rounded-md border border-green-500/50 hover:bg-green-500/40 transition-colors\">> Ready</button> <button hx-post=\"")
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
+			var templ_7745c5c3_Var5 string
+			templ_7745c5c3_Var5, templ_7745c5c3_Err = templ.JoinStringErrs(cancelUrl)
+			if templ_7745c5c3_Err != nil {
+				return templ.Error{Err: templ_7745c5c3_Err, FileName: `view/vote.templ`, Line: 25, Col: 42}
+			}
+			_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var5))
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 7, "\" data-ws-command=\"")
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
+			var templ_7745c5c3_Var6 string
+			templ_7745c5c3_Var6, templ_7745c5c3_Err = templ.JoinStringErrs(wsCommand(protocol.CommandCancelVote, "", ""))
+			if templ_7745c5c3_Err != nil {
+				return templ.Error{Err: templ_7745c5c3_Err, FileName: `view/vote.templ`, Line: 25, Col: 106}
+			}
+			_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var6))
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 8, "\" class=\"text-green-300 text-sm bg-gray-900/50 px-4 py-2 rounded-md border border-green-500/30 hover:bg-green-500/20 transition-colors\">> Cancel</button>")
 			if templ_7745c5c3_Err != nil {
 				return templ_7745c5c3_Err
 			}
 		}
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 7, "</div></div></div></div>")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 9, "</div></div></div></div>")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
@@ -119,12 +146,12 @@ func wsCancelVote() templ.Component {
 			}()
 		}
 		ctx = templ.InitializeContext(ctx)
-		templ_7745c5c3_Var5 := templ.GetChildren(ctx)
-		if templ_7745c5c3_Var5 == nil {
-			templ_7745c5c3_Var5 = templ.NopComponent
+		templ_7745c5c3_Var7 := templ.GetChildren(ctx)
+		if templ_7745c5c3_Var7 == nil {
+			templ_7745c5c3_Var7 = templ.NopComponent
 		}
 		ctx = templ.ClearChildren(ctx)
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 8, "<div id=\"popup\" hx-swap-oob=\"vote-popup\" class=\"vote-popup\"></div>")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 10, "<div id=\"popup\" hx-swap-oob=\"vote-popup\" class=\"vote-popup\"></div>")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
@@ -132,21 +159,21 @@ func wsCancelVote() templ.Component {
 	})
 }
 
-func RenderVote(c echo.Context, president bool, gid, toggled, originPid string, destP *entities.Player) error {
-	return renderView(c, vote(president, gid, toggled, originPid, destP))
+func RenderVote(c echo.Context, president bool, gid, toggled string, destP *entities.Player) error {
+	return renderView(c, vote(president, gid, toggled, destP))
 }
 
-func WsRenderVote(ws *websocket.Conn, gid, originPid string, destP *entities.Player) {
-	err := renderWebsocket(ws, vote(false, gid, "", originPid, destP))
+func WsRenderVote(ws socket.Client, president bool, gid, toggled string, destP *entities.Player) {
+	err := renderWebsocket(ws, vote(president, gid, toggled, destP))
 	if err != nil {
-		fmt.Println("Websocket error: ", err.Error())
+		slog.Debug("could not send to websocket", "err", err)
 	}
 }
 
-func WsRenderCancelVote(ws *websocket.Conn) {
+func WsRenderCancelVote(ws socket.Client) {
 	err := renderWebsocket(ws, wsCancelVote())
 	if err != nil {
-		fmt.Println("Websocket error: ", err.Error())
+		slog.Debug("could not send to websocket", "err", err)
 	}
 }
 
@@ -0,0 +1,97 @@
+package webhooks
+
+import (
+	"github.com/Neifen/secret-h/entities"
+	"github.com/Neifen/secret-h/events"
+	"github.com/Neifen/secret-h/protocol"
+)
+
+// Payload types
+const (
+	TypeGameCreated    = "game.created"
+	TypePlayerJoined   = "player.joined"
+	TypePlayerLeft     = "player.left"
+	TypePlayerExecuted = "player.executed"
+	TypeVoteOpened     = "vote.opened"
+	TypeVoteFinished   = "vote.finished"
+	TypePolicyEnacted  = "policy.enacted"
+	TypeGameOver       = "game.over"
+)
+
+type GameCreated struct {
+	Host protocol.Player `json:"host"`
+}
+
+type PlayerJoined struct {
+	Player protocol.Player `json:"player"`
+}
+
+type PlayerLeft struct {
+	Player protocol.Player `json:"player"`
+	// Reason is "left", "kicked" or "removed" by the operator, executed players get their own payload
+	Reason string `json:"reason"`
+}
+
+type PlayerExecuted struct {
+	Player protocol.Player `json:"player"`
+}
+
+type VoteOpened struct {
+	President protocol.Player `json:"president"`
+	Candidate protocol.Player `json:"candidate"`
+}
+
+type VoteFinished struct {
+	Result protocol.Result `json:"result"`
+}
+
+type PolicyEnacted struct {
+	Policy   string            `json:"policy"` // "liberal" or "fascist"
+	Policies protocol.Policies `json:"policies"`
+}
+
+type GameOver struct {
+	// Reason is "empty" when the last player left, "stale" when the game ran out of time, "ended" when the
+	// operator ended it
+	Reason string `json:"reason"`
+}
+
+// Observer turns the events of all games into payloads, for GamePool.Observe
+func (d *Dispatcher) Observer() events.Subscriber {
+	return func(ev events.Event) {
+		meta := ev.Source()
+		g := meta.Game
+		p := Payload{Game: g.Code, At: meta.At}
+
+		switch e := ev.(type) {
+		case events.GameCreated:
+			p.Type, p.Data = TypeGameCreated, GameCreated{Host: protocol.NewPlayer(g, e.Host)}
+		case events.PlayerJoined:
+			p.Type, p.Data = TypePlayerJoined, PlayerJoined{Player: protocol.NewPlayer(g, e.Player)}
+		case events.PlayerLeft:
+			if e.Reason == entities.Killed {
+				p.Type, p.Data = TypePlayerExecuted, PlayerExecuted{Player: protocol.NewPlayer(g, e.Player)}
+			} else {
+				p.Type, p.Data = TypePlayerLeft, PlayerLeft{Player: protocol.NewPlayer(g, e.Player), Reason: protocol.Reason(e.Reason)}
+			}
+		case events.VoteOpened:
+			p.Type, p.Data = TypeVoteOpened, VoteOpened{
+				President: protocol.NewPlayer(g, e.Vote.OriginPlayer),
+				Candidate: protocol.NewPlayer(g, e.Vote.DestPlayer),
+			}
+		case events.VoteFinished:
+			p.Type, p.Data = TypeVoteFinished, VoteFinished{Result: protocol.NewResult(e.Result)}
+		case events.PolicyEnacted:
+			p.Type, p.Data = TypePolicyEnacted, PolicyEnacted{Policy: string(e.Policy), Policies: protocol.NewPolicies(e.Policies)}
+		case events.GameEnded:
+			p.Type, p.Data = TypeGameOver, GameOver{Reason: e.Reason}
+			d.Send(p)
+			d.forget(g.Code)
+			return
+		default:
+			return
+		}
+
+		d.Send(p)
+	}
+}
@@ -0,0 +1,40 @@
+package webhooks
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+)
+
+// Receiver prints every delivery and whether its signature is valid, to try out webhooks locally.
+// The first failFirst deliveries are answered with an error, to see the retries.
+func Receiver(secret string, failFirst int, out io.Writer) http.Handler {
+	var received atomic.Int64
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		n := received.Add(1)
+		signature := "unsigned"
+		if secret != "" {
+			signature = "invalid signature"
+			if Verify(secret, r.Header, body) {
+				signature = "valid signature"
+			}
+		}
+
+		if n <= int64(failFirst) {
+			fmt.Fprintf(out, "#%d %v (%v), failing on purpose\n", n, r.Header.Get(HeaderEvent), r.Header.Get(HeaderDelivery))
+			http.Error(w, "failing on purpose", http.StatusServiceUnavailable)
+			return
+		}
+
+		fmt.Fprintf(out, "#%d %v (%v), %v: %s\n", n, r.Header.Get(HeaderEvent), r.Header.Get(HeaderDelivery), signature, body)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
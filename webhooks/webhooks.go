@@ -0,0 +1,337 @@
+// Package webhooks delivers the lifecycle of games as signed JSON to HTTP endpoints, e.g. for a scoreboard.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	mrand "math/rand"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// Headers of every delivery
+	HeaderEvent     = "X-Secret-H-Event"
+	HeaderDelivery  = "X-Secret-H-Delivery"
+	HeaderTimestamp = "X-Secret-H-Timestamp"
+	// HeaderSignature is "sha256=" followed by the hex HMAC-SHA256 of "<timestamp>.<body>" with the secret of the hook
+	HeaderSignature = "X-Secret-H-Signature"
+
+	queueSize   = 256
+	workers     = 4
+	maxAttempts = 6
+	// the first retry happens after baseBackoff, every following one waits twice as long, up to maxBackoff
+	baseBackoff = time.Second
+	maxBackoff  = time.Minute
+	sendTimeout = time.Second * 10
+)
+
+// Hook is an endpoint that receives payloads
+type Hook struct {
+	Id     string `json:"id"`
+	URL    string `json:"url"`
+	Secret string `json:"-"`
+}
+
+// Payload is the body of every delivery
+type Payload struct {
+	Id   string    `json:"id"`
+	Type string    `json:"type"` // one of the Type* constants
+	Game string    `json:"game"`
+	At   time.Time `json:"at"`
+	Data any       `json:"data,omitempty"`
+}
+
+type delivery struct {
+	hook    Hook
+	public  bool // the hook belongs to a game, only public addresses may be reached
+	payload Payload
+	body    []byte
+	attempt int
+}
+
+// Dispatcher delivers payloads to the hooks of the whole server and of single games. Delivering never blocks
+// the game, failed deliveries are retried in the background.
+//
+// The hooks of the server come from its operator and may point anywhere. The hooks of games come from their hosts,
+// so they only reach public addresses, otherwise anyone could make the server send requests to itself or into the
+// network behind it.
+type Dispatcher struct {
+	client       *http.Client
+	publicClient *http.Client // for the hooks of games
+	queue        chan *delivery
+
+	mu     sync.RWMutex
+	hooks  map[string][]Hook // game code - hooks, the server wide hooks under ""
+	closed bool              // set under mu, so no delivery is added to pending once Close waits for it
+
+	pending sync.WaitGroup // deliveries not yet delivered or given up
+}
+
+func NewDispatcher(serverHooks ...Hook) *Dispatcher {
+	d := &Dispatcher{
+		client:       &http.Client{Timeout: sendTimeout},
+		publicClient: publicClient(),
+		queue:        make(chan *delivery, queueSize),
+		hooks:        map[string][]Hook{"": serverHooks},
+	}
+
+	for i := 0; i < workers; i++ {
+		go d.work()
+	}
+	return d
+}
+
+// NewHook creates a hook with a fresh id
+func NewHook(url, secret string) Hook {
+	return Hook{Id: randomId(), URL: url, Secret: secret}
+}
+
+// Register adds a hook that only receives the payloads of one game
+func (d *Dispatcher) Register(game string, h Hook) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.hooks[game] = append(d.hooks[game], h)
+}
+
+// Unregister removes a hook of a game, false if the game has no such hook
+func (d *Dispatcher) Unregister(game, id string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	hooks := d.hooks[game]
+	for i, h := range hooks {
+		if h.Id == id {
+			d.hooks[game] = append(hooks[:i:i], hooks[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Hooks lists the hooks of a game
+func (d *Dispatcher) Hooks(game string) []Hook {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return append([]Hook{}, d.hooks[game]...)
+}
+
+// GameHooks returns the hooks of all games, e.g. to keep them over a restart
+func (d *Dispatcher) GameHooks() map[string][]Hook {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	hooks := map[string][]Hook{}
+	for game, hs := range d.hooks {
+		if game != "" && len(hs) > 0 {
+			hooks[game] = append([]Hook{}, hs...)
+		}
+	}
+	return hooks
+}
+
+// forget drops the hooks of a game that is over
+func (d *Dispatcher) forget(game string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.hooks, game)
+}
+
+// Send queues a payload for the server wide hooks and the hooks of its game
+func (d *Dispatcher) Send(p Payload) {
+	p.Id = randomId()
+
+	body, err := json.Marshal(p)
+	if err != nil {
+		slog.Error("could not encode webhook payload", "game", p.Game, "type", p.Type, "err", err)
+		return
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		return
+	}
+
+	for _, h := range d.hooks[""] {
+		d.enqueue(&delivery{hook: h, payload: p, body: body})
+	}
+	for _, h := range d.hooks[p.Game] {
+		d.enqueue(&delivery{hook: h, public: true, payload: p, body: body})
+	}
+}
+
+func (d *Dispatcher) enqueue(dl *delivery) {
+	d.pending.Add(1)
+	select {
+	case d.queue <- dl:
+	default:
+		slog.Warn("webhook queue full, dropping payload", "game", dl.payload.Game, "type", dl.payload.Type, "url", dl.hook.URL)
+		d.pending.Done()
+	}
+}
+
+// Close stops taking new payloads and waits until the queued ones are delivered or ctx is done
+func (d *Dispatcher) Close(ctx context.Context) error {
+	d.mu.Lock()
+	d.closed = true
+	d.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		d.pending.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (d *Dispatcher) work() {
+	for dl := range d.queue {
+		d.deliver(dl)
+	}
+}
+
+// deliver sends a payload once and schedules a retry if it failed for a reason that may go away
+func (d *Dispatcher) deliver(dl *delivery) {
+	dl.attempt++
+	retry, err := d.post(dl)
+	if err == nil {
+		d.pending.Done()
+		return
+	}
+
+	if !retry || dl.attempt >= maxAttempts {
+		slog.Error("webhook failed for good", "game", dl.payload.Game, "type", dl.payload.Type, "url", dl.hook.URL, "attempts", dl.attempt, "err", err)
+		d.pending.Done()
+		return
+	}
+
+	wait := backoff(dl.attempt)
+	slog.Warn("webhook failed, retrying", "game", dl.payload.Game, "type", dl.payload.Type, "url", dl.hook.URL, "retry_in", wait, "err", err)
+	time.AfterFunc(wait, func() {
+		d.queue <- dl
+	})
+}
+
+// post sends the payload, retry tells whether a failure is worth trying again
+func (d *Dispatcher) post(dl *delivery) (bool, error) {
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequest(http.MethodPost, dl.hook.URL, bytes.NewReader(dl.body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "secret-h-webhooks")
+	req.Header.Set(HeaderEvent, dl.payload.Type)
+	req.Header.Set(HeaderDelivery, dl.payload.Id)
+	req.Header.Set(HeaderTimestamp, ts)
+	if dl.hook.Secret != "" {
+		req.Header.Set(HeaderSignature, Sign(dl.hook.Secret, ts, dl.body))
+	}
+
+	client := d.client
+	if dl.public {
+		client = d.publicClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		// a hook on a private address stays there
+		return !errors.Is(err, errNotPublic), err
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	// the receiver is overloaded or broken, other client errors will not go away
+	retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusRequestTimeout
+	return retry, fmt.Errorf("receiver answered %v", resp.Status)
+}
+
+// backoff doubles with every attempt, with some jitter so retries of many deliveries do not arrive all at once
+func backoff(attempt int) time.Duration {
+	wait := time.Duration(float64(baseBackoff) * math.Pow(2, float64(attempt-1)))
+	if wait > maxBackoff {
+		wait = maxBackoff
+	}
+	return wait/2 + time.Duration(mrand.Int63n(int64(wait/2)+1))
+}
+
+var errNotPublic = errors.New("webhooks of games may only reach public addresses")
+
+// sharedAddresses are used by carriers behind NAT, they are as private as the ranges of IsPrivate
+var sharedAddresses = netip.MustParsePrefix("100.64.0.0/10")
+
+// publicClient refuses to connect to this machine and to private networks. It checks the address it actually
+// dials, after name resolution and on every redirect, so neither a DNS name nor a redirect leads around it.
+func publicClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: sendTimeout,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip, err := netip.ParseAddr(host)
+			if err != nil {
+				return err
+			}
+			if !isPublic(ip) {
+				return fmt.Errorf("%w, not %v", errNotPublic, ip)
+			}
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil // a proxy would dial the hook for us, unchecked
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: sendTimeout, Transport: transport}
+}
+
+func isPublic(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !sharedAddresses.Contains(ip)
+}
+
+// Sign creates the value of HeaderSignature
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature of a delivery, for receivers
+func Verify(secret string, header http.Header, body []byte) bool {
+	expected := Sign(secret, header.Get(HeaderTimestamp), body)
+	return hmac.Equal([]byte(expected), []byte(header.Get(HeaderSignature)))
+}
+
+func randomId() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,209 @@
+package webhooks
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIsPublic(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.178.1", false},
+		{"100.64.0.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"224.0.0.1", false},
+	}
+
+	for _, tt := range tests {
+		if got := isPublic(netip.MustParseAddr(tt.ip)); got != tt.want {
+			t.Errorf("isPublic(%v) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestGameHooksOnlyReachPublicAddresses(t *testing.T) {
+	var received atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		received.Add(1)
+	}))
+	defer srv.Close()
+
+	// the operator may send to this machine, the host of a game may not, by address or by name
+	d := NewDispatcher(NewHook(srv.URL, ""))
+	d.Register("42", NewHook(srv.URL, ""))
+	u, _ := url.Parse(srv.URL)
+	d.Register("42", NewHook("http://localhost:"+u.Port(), ""))
+	d.Send(Payload{Type: TypeGameCreated, Game: "42", At: time.Now()})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := d.Close(ctx); err != nil {
+		t.Fatalf("deliveries to private addresses should not be retried: %v", err)
+	}
+	if n := received.Load(); n != 1 {
+		t.Errorf("received %v deliveries, want only the one of the server hook", n)
+	}
+}
+
+func TestRetriesFlakyReceiver(t *testing.T) {
+	var attempts atomic.Int32
+	deliveries := make(chan string, 3)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !Verify("s3cret", r.Header, body) {
+			t.Error("retry is not signed")
+		}
+		deliveries <- r.Header.Get(HeaderDelivery)
+
+		switch attempts.Add(1) {
+		case 1:
+			// longer than the client waits
+			<-r.Context().Done()
+		case 2:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	d := NewDispatcher(NewHook(srv.URL, "s3cret"))
+	d.client.Timeout = 100 * time.Millisecond
+	start := time.Now()
+	d.Send(Payload{Type: TypeVoteOpened, Game: "42", At: time.Now()})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := d.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := attempts.Load(); n != 3 {
+		t.Fatalf("%v attempts, want a timeout, a 503 and the delivery", n)
+	}
+	// the waits after the first and second attempt are at least half of 1s and 2s
+	if took := time.Since(start); took < baseBackoff*3/2 {
+		t.Errorf("retried after %v, without backing off", took)
+	}
+	if a, b, c := <-deliveries, <-deliveries, <-deliveries; a == "" || a != b || b != c {
+		t.Errorf("delivery ids %q, %q, %q, retries should keep the id", a, b, c)
+	}
+}
+
+func TestClientErrorsAreNotRetried(t *testing.T) {
+	var attempts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusGone)
+	}))
+	defer srv.Close()
+
+	d := NewDispatcher(NewHook(srv.URL, ""))
+	d.Send(Payload{Type: TypeGameCreated, Game: "42", At: time.Now()})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := d.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := attempts.Load(); n != 1 {
+		t.Errorf("%v attempts, want 1", n)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for attempt := 1; attempt < maxAttempts+3; attempt++ {
+		wait := min(baseBackoff<<(attempt-1), maxBackoff)
+		for range 20 {
+			if got := backoff(attempt); got < wait/2 || got > wait {
+				t.Fatalf("backoff(%v) = %v, want between %v and %v", attempt, got, wait/2, wait)
+			}
+		}
+	}
+}
+
+func TestSendAfterClose(t *testing.T) {
+	var received atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		received.Add(1)
+	}))
+	defer srv.Close()
+
+	d := NewDispatcher(NewHook(srv.URL, ""))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// run with -race, a game may still send while the server shuts down
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.Send(Payload{Type: TypePlayerLeft, Game: "42", At: time.Now()})
+		}()
+	}
+	if err := d.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	sent := received.Load()
+	wg.Wait()
+
+	d.Send(Payload{Type: TypePlayerLeft, Game: "42", At: time.Now()})
+	time.Sleep(50 * time.Millisecond)
+	if n := received.Load(); n != sent {
+		t.Errorf("%v deliveries after Close returned", n-sent)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"type":"` + TypeVoteFinished + `"}`)
+	signed := func(secret, timestamp string, b []byte) http.Header {
+		h := http.Header{}
+		h.Set(HeaderTimestamp, timestamp)
+		h.Set(HeaderSignature, Sign(secret, timestamp, b))
+		return h
+	}
+
+	tests := []struct {
+		name   string
+		header http.Header
+		body   []byte
+		ok     bool
+	}{
+		{name: "valid", header: signed("s3cret", "1700000000", body), body: body, ok: true},
+		{name: "other secret", header: signed("other", "1700000000", body), body: body},
+		{name: "body changed", header: signed("s3cret", "1700000000", body), body: []byte(`{"type":"` + TypeVoteOpened + `"}`)},
+		{name: "timestamp changed", header: func() http.Header {
+			h := signed("s3cret", "1700000000", body)
+			h.Set(HeaderTimestamp, "1700000001")
+			return h
+		}(), body: body},
+		{name: "unsigned", header: http.Header{}, body: body},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Verify("s3cret", tt.header, tt.body); got != tt.ok {
+				t.Errorf("Verify = %v, want %v", got, tt.ok)
+			}
+		})
+	}
+}